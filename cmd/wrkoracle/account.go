@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/unification-com/mainchain/accounts"
+	"github.com/unification-com/mainchain/accounts/keystore"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	accountCommand = cli.Command{
+		Name:     "account",
+		Usage:    "Manage the Oracle's keystore accounts",
+		Category: "ORACLE COMMANDS",
+		Description: `
+The account commands manage the accounts in the keystore in the data directory.`,
+		Subcommands: []cli.Command{
+			{
+				Action:    accountNew,
+				Name:      "new",
+				Usage:     "Generate a new account",
+				ArgsUsage: "",
+				Flags: []cli.Flag{
+					PasswordPathFlag,
+					PasswordFDFlag,
+					StrictPermsFlag,
+					DataDirectoryFlag,
+				},
+				Description: `
+The new command generates a new private key, and stores it in the keystore encrypted with --password.`,
+			},
+			{
+				Action:    accountList,
+				Name:      "list",
+				Usage:     "List the accounts in the keystore",
+				ArgsUsage: "",
+				Flags: []cli.Flag{
+					DataDirectoryFlag,
+				},
+				Description: `
+The list command outputs the address and key file of each account in the keystore.`,
+			},
+			{
+				Action:    accountImport,
+				Name:      "import",
+				Usage:     "Import a JSON key file",
+				ArgsUsage: "<key file>",
+				Flags: []cli.Flag{
+					PasswordPathFlag,
+					PasswordFDFlag,
+					StrictPermsFlag,
+					NewPasswordPathFlag,
+					DataDirectoryFlag,
+				},
+				Description: `
+The import command imports an existing geth style JSON key file, encrypted with --password, into the
+keystore. The imported key is encrypted with --new-password if set, otherwise with --password.`,
+			},
+			{
+				Action:    accountExport,
+				Name:      "export",
+				Usage:     "Export an account as a JSON key file",
+				ArgsUsage: "<key file>",
+				Flags: []cli.Flag{
+					AccountUnlockFlag,
+					PasswordPathFlag,
+					PasswordFDFlag,
+					StrictPermsFlag,
+					NewPasswordPathFlag,
+					DataDirectoryFlag,
+				},
+				Description: `
+The export command writes --account's key to the given path, as a JSON key file. The exported key is
+encrypted with --new-password if set, otherwise with --password.`,
+			},
+			{
+				Action:    accountChangePassword,
+				Name:      "password",
+				Usage:     "Change an account's password",
+				ArgsUsage: "",
+				Flags: []cli.Flag{
+					AccountUnlockFlag,
+					PasswordPathFlag,
+					PasswordFDFlag,
+					StrictPermsFlag,
+					NewPasswordPathFlag,
+					DataDirectoryFlag,
+				},
+				Description: `
+The password command re-encrypts --account's key, currently encrypted with --password, with --new-password.
+If --new-password is not set, the new password is prompted for.`,
+			},
+			{
+				Action:    accountInspect,
+				Name:      "inspect",
+				Usage:     "Show an account's address and balance",
+				ArgsUsage: "",
+				Flags: []cli.Flag{
+					AccountUnlockFlag,
+					PasswordPathFlag,
+					PasswordFDFlag,
+					StrictPermsFlag,
+					DataDirectoryFlag,
+					MainchainJSONRPCFlag,
+					MainchainMaxHeadDriftFlag,
+					MainchainChainIDFlag,
+					UndTestnetFlag,
+				},
+				Description: `
+The inspect command outputs --account's address, key file and Mainchain balance. If --password,
+--password-fd or WRKORACLE_PASSWORD is set, it also checks that the password decrypts the key.`,
+			},
+			{
+				Action:    accountBackup,
+				Name:      "backup",
+				Usage:     "Split an encrypted backup of an account into shares",
+				ArgsUsage: "<output dir>",
+				Flags: []cli.Flag{
+					AccountUnlockFlag,
+					PasswordPathFlag,
+					PasswordFDFlag,
+					StrictPermsFlag,
+					NewPasswordPathFlag,
+					BackupSharesFlag,
+					BackupThresholdFlag,
+					DataDirectoryFlag,
+				},
+				Description: `
+The backup command exports --account's key, encrypted with --new-password if set, otherwise with
+--password, and splits it into --shares Shamir secret shares, any --threshold of which recover it.
+Each share is written to its own file in the output directory, to be printed or stored separately.
+Fewer than --threshold shares reveal nothing about the key.`,
+			},
+			{
+				Action:    accountRecover,
+				Name:      "recover",
+				Usage:     "Recover an account from backup shares",
+				ArgsUsage: "<share file> <share file> ...",
+				Flags: []cli.Flag{
+					PasswordPathFlag,
+					PasswordFDFlag,
+					StrictPermsFlag,
+					NewPasswordPathFlag,
+					DataDirectoryFlag,
+				},
+				Description: `
+The recover command combines at least the threshold number of shares written by the backup command,
+and imports the recovered key into the keystore. --password is the password the backup was encrypted
+with. The recovered key is encrypted with --new-password if set, otherwise with --password.`,
+			},
+		},
+	}
+)
+
+// openKeystore open the keystore in the data directory
+func openKeystore(ctx *cli.Context) *keystore.KeyStore {
+	return keystore.NewKeyStore(filepath.Join(ctx.String(DataDirectoryFlag.Name), "keys"), keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+// accountPassword the password for the keystore account. See readPassword
+func accountPassword(ctx *cli.Context, confirm bool) string {
+	pass, err := readPassword(ctx, confirm)
+	if err != nil {
+		Fatalf("Failed to read account password: %v", err)
+	}
+	return pass
+}
+
+// newAccountPassword the new password for the keystore account, read from --new-password. If
+// --new-password is not set, the current password is used
+func newAccountPassword(ctx *cli.Context, current string) string {
+	if !ctx.IsSet(NewPasswordPathFlag.Name) {
+		return current
+	}
+	pass, err := readNewPassword(ctx)
+	if err != nil {
+		Fatalf("Failed to read new password: %v", err)
+	}
+	return pass
+}
+
+// findAccount find --account in the keystore
+func findAccount(ctx *cli.Context, ks *keystore.KeyStore) accounts.Account {
+	acc, err := ks.Find(accounts.Account{Address: accountFromFlag(ctx)})
+	if err != nil {
+		Fatalf("Could not find account. Did you init first?: %v", err)
+	}
+	return acc
+}
+
+func accountNew(ctx *cli.Context) error {
+	MkDataDir(ctx.String(DataDirectoryFlag.Name))
+	pass := accountPassword(ctx, true)
+
+	acc, err := openKeystore(ctx).NewAccount(pass)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Account", acc.Address.Hex(), "created")
+	fmt.Println("Key file:", acc.URL.Path)
+	return nil
+}
+
+func accountList(ctx *cli.Context) error {
+	accs := openKeystore(ctx).Accounts()
+	if len(accs) == 0 {
+		fmt.Println("No accounts in", filepath.Join(ctx.String(DataDirectoryFlag.Name), "keys"))
+		return nil
+	}
+	for i, acc := range accs {
+		fmt.Printf("Account #%d: %s %s\n", i, acc.Address.Hex(), acc.URL.Path)
+	}
+	return nil
+}
+
+func accountImport(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("path to key file required")
+	}
+	keyJSON, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	MkDataDir(ctx.String(DataDirectoryFlag.Name))
+	pass := accountPassword(ctx, false)
+
+	acc, err := openKeystore(ctx).Import(keyJSON, pass, newAccountPassword(ctx, pass))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Account", acc.Address.Hex(), "imported")
+	fmt.Println("Key file:", acc.URL.Path)
+	return nil
+}
+
+func accountExport(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("path to write the key file to required")
+	}
+	ks := openKeystore(ctx)
+	acc := findAccount(ctx, ks)
+	pass := accountPassword(ctx, false)
+
+	keyJSON, err := ks.Export(acc, pass, newAccountPassword(ctx, pass))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(ctx.Args().First(), keyJSON, 0600); err != nil {
+		return err
+	}
+
+	fmt.Println("Account", acc.Address.Hex(), "exported to", ctx.Args().First())
+	return nil
+}
+
+func accountChangePassword(ctx *cli.Context) error {
+	ks := openKeystore(ctx)
+	acc := findAccount(ctx, ks)
+	pass := accountPassword(ctx, false)
+
+	newPass, err := readNewPassword(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ks.Update(acc, pass, newPass); err != nil {
+		return err
+	}
+
+	fmt.Println("Password changed for account", acc.Address.Hex())
+	return nil
+}
+
+func accountInspect(ctx *cli.Context) error {
+	ks := openKeystore(ctx)
+	acc := findAccount(ctx, ks)
+
+	fmt.Println("Address:", acc.Address.Hex())
+	fmt.Println("Key file:", acc.URL.Path)
+
+	if passwordSourceSet(ctx) {
+		keyJSON, err := ioutil.ReadFile(acc.URL.Path)
+		if err != nil {
+			return err
+		}
+		if _, err := keystore.DecryptKey(keyJSON, accountPassword(ctx, false)); err != nil {
+			fmt.Println("Password: does not decrypt key:", err)
+		} else {
+			fmt.Println("Password: decrypts key")
+		}
+	}
+
+	mainchainClient := connectMainchain(ctx)
+	balance, err := mainchainClient.BalanceAt(context.Background(), acc.Address, nil)
+	if err != nil {
+		return err
+	}
+	nonce, err := mainchainClient.NonceAt(context.Background(), acc.Address, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Balance:", weiToUnd(balance), "UND")
+	fmt.Println("Nonce:", nonce)
+	return nil
+}
+
+func accountBackup(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("path to the directory to write the shares to required")
+	}
+	outDir := ctx.Args().First()
+	ks := openKeystore(ctx)
+	acc := findAccount(ctx, ks)
+	pass := accountPassword(ctx, false)
+
+	keyJSON, err := ks.Export(acc, pass, newAccountPassword(ctx, pass))
+	if err != nil {
+		return err
+	}
+	shares, err := splitSecret(keyJSON, ctx.Int(BackupSharesFlag.Name), ctx.Int(BackupThresholdFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return err
+	}
+	for _, share := range shares {
+		path := filepath.Join(outDir, fmt.Sprintf("%s-share-%d-of-%d.txt", acc.Address.Hex(), share.x, len(shares)))
+		if err := ioutil.WriteFile(path, []byte(share.String()+"\n"), 0600); err != nil {
+			return err
+		}
+		fmt.Println("Share", share.x, "written to", path)
+	}
+
+	fmt.Printf("Account %s backed up to %d shares. Any %d of them recover it, with the account's password\n", acc.Address.Hex(), len(shares), shares[0].threshold)
+	fmt.Println("Store the shares separately, and delete them from", outDir, "once they are stored")
+	return nil
+}
+
+func accountRecover(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("paths to share files required")
+	}
+	var shares []*secretShare
+	for _, path := range ctx.Args() {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		share, err := parseSecretShare(string(blob))
+		if err != nil {
+			return fmt.Errorf("invalid share file %s: %v", path, err)
+		}
+		shares = append(shares, share)
+	}
+
+	keyJSON, err := combineShares(shares)
+	if err != nil {
+		return err
+	}
+
+	MkDataDir(ctx.String(DataDirectoryFlag.Name))
+	pass := accountPassword(ctx, false)
+
+	acc, err := openKeystore(ctx).Import(keyJSON, pass, newAccountPassword(ctx, pass))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Account", acc.Address.Hex(), "recovered")
+	fmt.Println("Key file:", acc.URL.Path)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/log"
+	"sync"
+)
+
+// errNoOracleAccount returned when none of the Oracle's accounts can send the next Tx
+var errNoOracleAccount = errors.New("no Oracle account has enough UND to pay the tax and no stuck Txs")
+
+// oracleAccount an authorised account the Oracle records with, along with the Tx manager which
+// tracks its nonces and pending Txs
+type oracleAccount struct {
+	address common.Address
+	txm     *txManager
+}
+
+// accountPool rotates recordings across the Oracle's accounts, so that each account has its own
+// nonce sequence, and a stuck Tx only holds up the account which sent it
+type accountPool struct {
+	mu       sync.Mutex
+	client   *MainchainClient
+	accounts []*oracleAccount
+	balances *balanceMonitor
+	treasury *treasury
+	next     int
+}
+
+// newAccountPool create a pool of the given accounts, whose balances are checked against the
+// balance monitor's low balance threshold. If treasury is not nil, accounts are topped up from it
+func newAccountPool(client *MainchainClient, accounts []*oracleAccount, balances *balanceMonitor, treasury *treasury) *accountPool {
+	return &accountPool{
+		client:   client,
+		accounts: accounts,
+		balances: balances,
+		treasury: treasury,
+	}
+}
+
+// Next the next account in turn which has enough UND to pay the tax, and no stuck Txs. Accounts
+// which are skipped are reported, so that they can be topped up or unstuck
+func (p *accountPool) Next(bgCtx context.Context) (*oracleAccount, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := 0; i < len(p.accounts); i++ {
+		acc := p.accounts[(p.next+i)%len(p.accounts)]
+
+		balance, err := p.client.BalanceAt(bgCtx, acc.address, nil)
+		if err != nil {
+			log.Warn("Could not get balance", "account", acc.address.Hex(), "err", err)
+			continue
+		}
+		log.Info("Balance", "account", acc.address.Hex(), "und", weiToUnd(balance))
+		und, _ := weiToUnd(balance).Float64()
+		metrics.balance.Set(und, acc.address.Hex())
+		p.balances.Check(acc.address, balance)
+		if p.treasury != nil {
+			p.treasury.Check(bgCtx, acc.address, balance)
+		}
+
+		if balance.Cmp(calcTax()) == -1 {
+			log.Warn("Not enough UND to record - skipping account", "account", acc.address.Hex(), "und", weiToUnd(balance))
+			continue
+		}
+		if acc.txm.Stuck() {
+			log.Warn("Account has stuck Txs - skipping", "account", acc.address.Hex())
+			continue
+		}
+
+		p.next = (p.next + i + 1) % len(p.accounts)
+		return acc, nil
+	}
+
+	return nil, errNoOracleAccount
+}
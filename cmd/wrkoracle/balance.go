@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// balanceMonitor warns when an Oracle account's balance falls below the low balance threshold: the
+// greater of enough UND for --balance.warn.recordings recordings, and --balance.warn.und. Each
+// recording costs the WRKChain Root tax plus the Tx fee
+type balanceMonitor struct {
+	mu            sync.Mutex
+	minRecordings uint64
+	minUND        *big.Int
+	interval      time.Duration
+	fee           *big.Int
+	low           map[common.Address]bool
+	balances      map[common.Address]*big.Int
+}
+
+// newBalanceMonitor create a balance monitor for the accounts, which each record once every
+// interval, as recordings are rotated across them
+func newBalanceMonitor(ctx *cli.Context, interval time.Duration) *balanceMonitor {
+	minUND, err := undToWei(ctx.String(BalanceWarnUndFlag.Name))
+	if err != nil {
+		Fatalf("Invalid --%s: %v", BalanceWarnUndFlag.Name, err)
+	}
+	return &balanceMonitor{
+		minRecordings: ctx.Uint64(BalanceWarnRecordingsFlag.Name),
+		minUND:        minUND,
+		interval:      interval,
+		fee:           big.NewInt(0),
+		low:           make(map[common.Address]bool),
+		balances:      make(map[common.Address]*big.Int),
+	}
+}
+
+// RecordedFee update the estimated cost of a recording with the maximum fee of the latest
+// recordHeader Tx
+func (b *balanceMonitor) RecordedFee(fee *big.Int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fee = new(big.Int).Set(fee)
+}
+
+// recordingCost the estimated cost of a recording. Caller must hold the lock
+func (b *balanceMonitor) recordingCost() *big.Int {
+	return new(big.Int).Add(calcTax(), b.fee)
+}
+
+// threshold the low balance threshold. Caller must hold the lock
+func (b *balanceMonitor) threshold() *big.Int {
+	threshold := new(big.Int).Mul(b.recordingCost(), new(big.Int).SetUint64(b.minRecordings))
+	if b.minUND.Cmp(threshold) > 0 {
+		threshold.Set(b.minUND)
+	}
+	return threshold
+}
+
+// Threshold the low balance threshold
+func (b *balanceMonitor) Threshold() *big.Int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold()
+}
+
+// Balance the account's balance when it was last checked, and whether it has been checked yet
+func (b *balanceMonitor) Balance(account common.Address) (*big.Int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	balance, ok := b.balances[account]
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).Set(balance), true
+}
+
+// Remaining the number of recordings the balance pays for, and the estimated time until it runs out
+func (b *balanceMonitor) Remaining(balance *big.Int) (uint64, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	recordings := new(big.Int).Div(balance, b.recordingCost()).Uint64()
+	return recordings, time.Duration(recordings) * b.interval
+}
+
+// Check compare the account's balance with the low balance threshold. When the balance falls below
+// the threshold, a warning is logged and the notification hooks are called. The warning is not
+// repeated until the balance has recovered above the threshold
+func (b *balanceMonitor) Check(account common.Address, balance *big.Int) {
+	recordings, remaining := b.Remaining(balance)
+	metrics.fundsRemaining.Set(remaining.Seconds(), account.Hex())
+
+	b.mu.Lock()
+	threshold := b.threshold()
+	wasLow := b.low[account]
+	isLow := threshold.Sign() > 0 && balance.Cmp(threshold) < 0
+	b.low[account] = isLow
+	b.balances[account] = new(big.Int).Set(balance)
+	b.mu.Unlock()
+
+	if isLow {
+		metrics.balanceLow.Set(1, account.Hex())
+	} else {
+		metrics.balanceLow.Set(0, account.Hex())
+	}
+
+	fields := []interface{}{
+		"account", account.Hex(),
+		"und", weiToUnd(balance),
+		"threshold", weiToUnd(threshold),
+		"recordings", recordings,
+		"remaining", remaining.Round(time.Second),
+	}
+	switch {
+	case isLow && !wasLow:
+		log.Warn("Balance below low balance threshold - top up the account", fields...)
+		notify(EventLowBalance, "Balance below low balance threshold", fields...)
+	case !isLow && wasLow:
+		log.Info("Balance recovered above low balance threshold", fields...)
+	}
+}
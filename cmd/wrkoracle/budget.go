@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+BudgetDaily: the budget for each UTC day
+BudgetMonthly: the budget for each UTC calendar month
+*/
+const (
+	BudgetDaily   = "daily"
+	BudgetMonthly = "monthly"
+)
+
+/*
+recordHeaderGasEstimate: typical gas used by a recordHeader Tx, used by the cost command
+defaultCostGasPrice: gas price, in wei, used by the cost command if neither --gas.price nor --mainchain.rpc is set
+averageMonth: average length of a calendar month, used to project monthly spend
+*/
+const (
+	recordHeaderGasEstimate uint64 = 200000
+	defaultCostGasPrice     uint64 = 1000000000
+	averageMonth                   = 2629800 * time.Second
+)
+
+var costCommand = cli.Command{
+	Action:    projectCost,
+	Name:      "cost",
+	Usage:     "Project the UND spent recording at a given frequency",
+	ArgsUsage: "",
+	Flags: []cli.Flag{
+		WriteFrequencyFlag,
+		CostGasFlag,
+		GasPriceFlag,
+		GasPriceStrategyFlag,
+		GasPricePercentileFlag,
+		GasPriceBlocksFlag,
+		GasPriceMaxFlag,
+		MainchainJSONRPCFlag,
+		MainchainMaxHeadDriftFlag,
+		MainchainChainIDFlag,
+		UndTestnetFlag,
+		BudgetDailyFlag,
+		BudgetMonthlyFlag,
+	},
+	Category: "ORACLE COMMANDS",
+	Description: `
+The cost command projects the daily and monthly UND spent recording once every --freq seconds, at
+the WRKChain Root tax plus the Tx fee per recording. The gas price is --gas.price if set, otherwise
+the --mainchain.rpc node's gas price if set, otherwise 1 Gwei. If --budget.daily or
+--budget.monthly are set, it also reports whether --freq fits within them.`,
+}
+
+// budgetLedger the UND spent recording in the current UTC day and month
+type budgetLedger struct {
+	Day        string   `json:"day"`
+	DaySpent   *big.Int `json:"dayspent"`
+	Month      string   `json:"month"`
+	MonthSpent *big.Int `json:"monthspent"`
+}
+
+// budgetPeriod the state of a single budget, at a point in time
+type budgetPeriod struct {
+	name   string
+	budget *big.Int
+	spent  *big.Int
+	end    time.Time
+}
+
+// spendBudget limits the UND spent recording per UTC day and month. Each recording is counted at
+// its estimated cost - the WRKChain Root tax plus the Tx's maximum fee - when it is submitted. Once
+// --budget.stretch percent of a budget is spent, the recording interval is stretched so that the
+// rest of the budget lasts until the end of the day or month. Once a budget can't pay for another
+// recording, recording is paused until the next day or month. Spending is recorded in the data
+// directory, so that it survives restarts
+type spendBudget struct {
+	mu        sync.Mutex
+	path      string
+	daily     *big.Int
+	monthly   *big.Int
+	stretchAt int64
+	cost      *big.Int
+	ledger    budgetLedger
+	stretched bool
+	paused    bool
+}
+
+// newSpendBudget configure the budgets from the --budget.* flags, loading the UND spent so far
+// from the data directory
+func newSpendBudget(ctx *cli.Context) *spendBudget {
+	daily, err := undToWei(ctx.String(BudgetDailyFlag.Name))
+	if err != nil {
+		Fatalf("Invalid --%s: %v", BudgetDailyFlag.Name, err)
+	}
+	monthly, err := undToWei(ctx.String(BudgetMonthlyFlag.Name))
+	if err != nil {
+		Fatalf("Invalid --%s: %v", BudgetMonthlyFlag.Name, err)
+	}
+	stretchAt := ctx.Uint64(BudgetStretchFlag.Name)
+	if stretchAt > 100 {
+		Fatalf("Invalid --%s: must be a percentage, from 0 to 100", BudgetStretchFlag.Name)
+	}
+
+	b := &spendBudget{
+		path:      filepath.Join(ctx.String(DataDirectoryFlag.Name), "budget.json"),
+		daily:     daily,
+		monthly:   monthly,
+		stretchAt: int64(stretchAt),
+		cost:      calcTax(),
+	}
+
+	blob, err := ioutil.ReadFile(b.path)
+	if err == nil {
+		err = json.Unmarshal(blob, &b.ledger)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		Fatalf("Could not load budget ledger %s: %v", b.path, err)
+	}
+
+	if daily.Sign() > 0 || monthly.Sign() > 0 {
+		log.Info("Recording budget", "daily", weiToUnd(daily), "monthly", weiToUnd(monthly), "stretch", fmt.Sprintf("%d%%", stretchAt))
+	}
+	return b
+}
+
+// roll start a new day or month's spending, if the current one has ended. Caller must hold the lock
+func (b *spendBudget) roll(now time.Time) {
+	day := now.Format("2006-01-02")
+	if b.ledger.Day != day || b.ledger.DaySpent == nil {
+		b.ledger.Day = day
+		b.ledger.DaySpent = new(big.Int)
+	}
+	month := now.Format("2006-01")
+	if b.ledger.Month != month || b.ledger.MonthSpent == nil {
+		b.ledger.Month = month
+		b.ledger.MonthSpent = new(big.Int)
+	}
+}
+
+// save write the budget ledger to disk. Caller must hold the lock
+func (b *spendBudget) save() error {
+	blob, err := json.MarshalIndent(b.ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0700); err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// periods the configured budgets, at the time now. Caller must hold the lock
+func (b *spendBudget) periods(now time.Time) []budgetPeriod {
+	b.roll(now)
+	var periods []budgetPeriod
+	if b.daily.Sign() > 0 {
+		periods = append(periods, budgetPeriod{
+			name:   BudgetDaily,
+			budget: b.daily,
+			spent:  b.ledger.DaySpent,
+			end:    time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	if b.monthly.Sign() > 0 {
+		periods = append(periods, budgetPeriod{
+			name:   BudgetMonthly,
+			budget: b.monthly,
+			spent:  b.ledger.MonthSpent,
+			end:    time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return periods
+}
+
+// Spent count the cost of a submitted recording against the budgets, and use it as the estimated
+// cost of later recordings
+func (b *spendBudget) Spent(cost *big.Int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll(time.Now().UTC())
+	b.ledger.DaySpent.Add(b.ledger.DaySpent, cost)
+	b.ledger.MonthSpent.Add(b.ledger.MonthSpent, cost)
+	b.cost = new(big.Int).Set(cost)
+
+	daySpent, _ := weiToUnd(b.ledger.DaySpent).Float64()
+	monthSpent, _ := weiToUnd(b.ledger.MonthSpent).Float64()
+	metrics.budgetSpent.Set(daySpent, BudgetDaily)
+	metrics.budgetSpent.Set(monthSpent, BudgetMonthly)
+
+	if err := b.save(); err != nil {
+		log.Warn("Could not save budget ledger", "path", b.path, "err", err)
+	}
+}
+
+// Next the time to wait before the next poll, and whether recording is paused. The wait is freq,
+// stretched if a budget is nearly spent so that the rest of it lasts until the end of its day or
+// month. If a budget can't pay for another recording, recording is paused until it renews
+func (b *spendBudget) Next(freq time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now().UTC()
+	interval := freq
+	var exhausted *budgetPeriod
+	var stretchedBy *budgetPeriod
+
+	for _, p := range b.periods(now) {
+		p := p
+		remaining := new(big.Int).Sub(p.budget, p.spent)
+		if remaining.Cmp(b.cost) < 0 {
+			if exhausted == nil || p.end.After(exhausted.end) {
+				exhausted = &p
+			}
+			continue
+		}
+
+		// percentage of the budget spent
+		used := new(big.Int).Div(new(big.Int).Mul(p.spent, big.NewInt(100)), p.budget)
+		if used.Int64() < b.stretchAt {
+			continue
+		}
+		recordings := new(big.Int).Div(remaining, b.cost).Int64()
+		if stretched := p.end.Sub(now) / time.Duration(recordings); stretched > interval {
+			interval = stretched
+			stretchedBy = &p
+		}
+	}
+
+	if exhausted != nil {
+		wait := exhausted.end.Sub(now)
+		metrics.recordInterval.Set(wait.Seconds())
+		if !b.paused {
+			b.paused = true
+			fields := []interface{}{
+				"budget", exhausted.name,
+				"spent", weiToUnd(exhausted.spent),
+				"limit", weiToUnd(exhausted.budget),
+				"resume", exhausted.end.Format(time.RFC3339),
+			}
+			log.Warn("Recording budget exhausted - pausing recording", fields...)
+			notify(EventBudgetExhausted, "Recording budget exhausted - pausing recording", fields...)
+		}
+		return wait, true
+	}
+	if b.paused {
+		b.paused = false
+		log.Info("Recording budget renewed - resuming recording")
+	}
+
+	metrics.recordInterval.Set(interval.Seconds())
+	switch {
+	case stretchedBy != nil && !b.stretched:
+		log.Warn("Recording budget nearly spent - stretching recording interval", "budget", stretchedBy.name, "spent", weiToUnd(stretchedBy.spent), "limit", weiToUnd(stretchedBy.budget), "interval", interval.Round(time.Second))
+	case stretchedBy != nil:
+		log.Debug("Stretched recording interval", "budget", stretchedBy.name, "interval", interval.Round(time.Second))
+	case b.stretched:
+		log.Info("Recording interval back to --freq", "interval", interval)
+	}
+	b.stretched = stretchedBy != nil
+
+	return interval, false
+}
+
+// costGasPrice the gas price the cost command projects with, and where it came from
+func costGasPrice(ctx *cli.Context) (*big.Int, string) {
+	switch {
+	case ctx.IsSet(GasPriceFlag.Name):
+		return new(big.Int).SetUint64(ctx.Uint64(GasPriceFlag.Name)), "--" + GasPriceFlag.Name
+	case ctx.IsSet(MainchainJSONRPCFlag.Name):
+		gasPrice, err := newGasStrategy(ctx, connectMainchain(ctx)).GasPrice(context.Background())
+		if err != nil {
+			Fatalf("Could not get gas price: %v", err)
+		}
+		return gasPrice, "Mainchain, " + ctx.String(GasPriceStrategyFlag.Name) + " strategy"
+	default:
+		return new(big.Int).SetUint64(defaultCostGasPrice), "default"
+	}
+}
+
+// minFrequency the shortest frequency, in seconds, at which recordings costing cost each stay
+// within the budget over the period
+func minFrequency(period time.Duration, cost *big.Int, budget *big.Int) int64 {
+	// recordings = budget / cost, frequency = period / recordings, rounded up
+	freq := new(big.Int).Mul(big.NewInt(int64(period/time.Second)), cost)
+	freq.Add(freq, new(big.Int).Sub(budget, big.NewInt(1)))
+	return freq.Div(freq, budget).Int64()
+}
+
+func projectCost(ctx *cli.Context) error {
+	frequency := ctx.Int64(WriteFrequencyFlag.Name)
+	if frequency <= 0 {
+		Fatalf("--%s must be more than 0", WriteFrequencyFlag.Name)
+	}
+	gas := ctx.Uint64(CostGasFlag.Name)
+	gasPrice, source := costGasPrice(ctx)
+
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gas), gasPrice)
+	cost := new(big.Int).Add(calcTax(), fee)
+
+	day := 24 * time.Hour
+	perDay := float64(day/time.Second) / float64(frequency)
+	perMonth := float64(averageMonth/time.Second) / float64(frequency)
+	costUND, _ := weiToUnd(cost).Float64()
+
+	fmt.Printf("Frequency:            %d seconds\n", frequency)
+	fmt.Printf("Cost per recording:   %v UND (%v UND tax + %v UND fee, %d gas at %v wei from %s)\n", weiToUnd(cost), weiToUnd(calcTax()), weiToUnd(fee), gas, gasPrice, source)
+	fmt.Printf("Recordings per day:   %.2f\n", perDay)
+	fmt.Printf("Projected daily:      %.4f UND\n", perDay*costUND)
+	fmt.Printf("Recordings per month: %.2f\n", perMonth)
+	fmt.Printf("Projected monthly:    %.4f UND\n", perMonth*costUND)
+
+	budgets := []struct {
+		flag   cli.StringFlag
+		period time.Duration
+	}{
+		{BudgetDailyFlag, day},
+		{BudgetMonthlyFlag, averageMonth},
+	}
+	for _, b := range budgets {
+		budget, err := undToWei(ctx.String(b.flag.Name))
+		if err != nil {
+			Fatalf("Invalid --%s: %v", b.flag.Name, err)
+		}
+		if budget.Sign() == 0 {
+			continue
+		}
+		minFreq := minFrequency(b.period, cost, budget)
+		status := "within budget"
+		if frequency < minFreq {
+			status = "OVER BUDGET - the interval will be stretched, and recording paused once it is spent"
+		}
+		fmt.Printf("--%s %v UND: %s. Minimum --freq within budget: %d seconds\n", b.flag.Name, weiToUnd(budget), status, minFreq)
+	}
+
+	return nil
+}
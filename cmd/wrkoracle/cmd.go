@@ -5,7 +5,6 @@ import (
 	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
-	"github.com/unification-com/mainchain/accounts"
 	"github.com/unification-com/mainchain/accounts/abi/bind"
 	"github.com/unification-com/mainchain/accounts/keystore"
 	"github.com/unification-com/mainchain/common"
@@ -14,9 +13,8 @@ import (
 	"github.com/unification-com/mainchain/core"
 	"github.com/unification-com/mainchain/crypto"
 	"github.com/unification-com/mainchain/ethclient"
+	"github.com/unification-com/mainchain/log"
 	"gopkg.in/urfave/cli.v1"
-	"io/ioutil"
-	"math"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -29,13 +27,15 @@ WRKChainRootContractAddress: Contract address, hard-coded into Mainchain's genes
 DepositStorageAddress: Storage address in WRKChain Root contract contaiing the required UND deposit amount, in wei
 DefaultMainchainTestnetRPC: Default UND Mainchain JSON RPC URL for testnet
 DefaultMainchainMainnetRPC: Default UND Mainchain JSON RPC URL for maainnet
+MainchainTestnetChainID: chain ID of UND Mainchain testnet, which Mainchain must report if --und-testnet is set
 */
 const (
 	WRKChainRootContractAddress = "0x0000000000000000000000000000000000000087"
 	DepositStorageAddress       = "0x0000000000000000000000000000000000000000000000000000000000000000"
 	DefaultMainchainTestnetRPC  = "https://rpc-testnet.unification.io"
 	DefaultMainchainMainnetRPC  = "https://rpc-testnet.unification.io"
-	WRKChainRootTax = 1
+	MainchainTestnetChainID     = 50005
+	WRKChainRootTax             = 1
 )
 
 var (
@@ -46,12 +46,19 @@ var (
 		ArgsUsage: "",
 		Flags: []cli.Flag{
 			PasswordPathFlag,
+			PasswordFDFlag,
+			StrictPermsFlag,
 			PrivateKeyPathFlag,
+			MnemonicPathFlag,
+			HDPathFlag,
+			HDIndexFlag,
+			ShredKeyFlag,
 			DataDirectoryFlag,
 		},
 		Category: "ORACLE COMMANDS",
 		Description: `
-The init command initialises the Oracle, creating a secure wallet for running.`,
+The init command initialises the Oracle, creating a secure wallet for running. The wallet's key is
+imported from --key, or derived from the BIP-39 mnemonic in --mnemonic-file.`,
 	}
 
 	registerCommand = cli.Command{
@@ -62,11 +69,32 @@ The init command initialises the Oracle, creating a secure wallet for running.`,
 		Flags: []cli.Flag{
 			AccountUnlockFlag,
 			PasswordPathFlag,
+			PasswordFDFlag,
+			StrictPermsFlag,
+			SignerFlag,
+			PolicyMaxGasPriceFlag,
+			PolicyDailySpendFlag,
 			DataDirectoryFlag,
 			GenesisPathFlag,
 			AuthorisedAccountsFlag,
+			UnsignedOutFlag,
 			MainchainJSONRPCFlag,
+			MainchainMaxHeadDriftFlag,
+			MainchainChainIDFlag,
 			UndTestnetFlag,
+			GasMarginFlag,
+			GasPriceStrategyFlag,
+			GasPriceFlag,
+			GasPricePercentileFlag,
+			GasPriceBlocksFlag,
+			GasPriceMaxFlag,
+			TxStuckTimeoutFlag,
+			TxGasBumpFlag,
+			LogLevelFlag,
+			LogFormatFlag,
+			LogFileFlag,
+			LogMaxSizeFlag,
+			LogMaxBackupsFlag,
 		},
 		Category: "ORACLE COMMANDS",
 		Description: `
@@ -81,23 +109,62 @@ The register command registers a new WRKChain on the UND Mainchain`,
 		Flags: []cli.Flag{
 			AccountUnlockFlag,
 			PasswordPathFlag,
+			PasswordFDFlag,
+			StrictPermsFlag,
+			SignerFlag,
+			PolicyMaxGasPriceFlag,
+			PolicyDailySpendFlag,
 			DataDirectoryFlag,
 			MainchainJSONRPCFlag,
+			MainchainHealthCheckFlag,
+			MainchainMaxHeadDriftFlag,
+			MainchainChainIDFlag,
 			UndTestnetFlag,
+			GasMarginFlag,
+			GasPriceStrategyFlag,
+			GasPriceFlag,
+			GasPricePercentileFlag,
+			GasPriceBlocksFlag,
+			GasPriceMaxFlag,
+			TxStuckTimeoutFlag,
+			TxGasBumpFlag,
+			BalanceWarnRecordingsFlag,
+			BalanceWarnUndFlag,
+			BudgetDailyFlag,
+			BudgetMonthlyFlag,
+			BudgetStretchFlag,
+			TreasuryAccountFlag,
+			TreasuryPasswordFlag,
+			TreasuryThresholdFlag,
+			TreasuryAmountFlag,
+			TreasuryDailyMaxFlag,
+			TreasuryAuditFlag,
+			WebhookURLFlag,
+			WebhookEventsFlag,
+			WebhookSecretFlag,
+			WebhookRetriesFlag,
 			WRKChainJSONRPCFlag,
 			WriteFrequencyFlag,
 			RecordParentHashFlag,
 			RecordReceiptRootFlag,
 			RecordTxRootFlag,
 			RecordStateRootFlag,
+			HookPreFlag,
+			HookPostFlag,
+			HookTimeoutFlag,
+			MetricsAddrFlag,
+			HealthSLAFlag,
+			LogLevelFlag,
+			LogFormatFlag,
+			LogFileFlag,
+			LogMaxSizeFlag,
+			LogMaxBackupsFlag,
 		},
 		Category: "ORACLE COMMANDS",
 		Description: `
 The record command runs the WRKChain Block Heaader Hash recorder and submits WRKChain hashes to Mainchain.
 A WRKChain requires registering first, with the register command`,
 	}
-
-	lastPendingNonce uint64 = 0
 )
 
 func initOracle(ctx *cli.Context) error {
@@ -105,34 +172,53 @@ func initOracle(ctx *cli.Context) error {
 	MkDataDir(ctx.String(DataDirectoryFlag.Name))
 
 	// Grab the password
-	if !ctx.IsSet(PasswordPathFlag.Name) {
-		Fatalf("Path to password file required")
-	}
-
-	blob, err := ioutil.ReadFile(ctx.String(PasswordPathFlag.Name))
+	pass, err := readPassword(ctx, true)
 
 	if err != nil {
-		Fatalf("Failed to read account password contents", "file", ctx.String(PasswordPathFlag.Name), "err", err)
+		Fatalf("Failed to read account password: %v", err)
 	}
-	pass := strings.TrimSpace(string(blob))
 
-	// Grab the private key
-	if !ctx.IsSet(PrivateKeyPathFlag.Name) {
-		Fatalf("Path to private key file required")
-	}
+	// Grab the private key, either from the key file or derived from the mnemonic
+	var privateKey *ecdsa.PrivateKey
+	keyPath := ctx.String(PrivateKeyPathFlag.Name)
 
-	blob, err = ioutil.ReadFile(ctx.String(PrivateKeyPathFlag.Name))
+	if ctx.IsSet(MnemonicPathFlag.Name) {
+		// hardened indexes would be derived as non-hardened ones, and larger indexes truncated
+		hdIndex := ctx.Uint64(HDIndexFlag.Name)
+		if hdIndex >= uint64(hdHardened) {
+			Fatalf("--%s %d too large. Must be less than %d", HDIndexFlag.Name, hdIndex, hdHardened)
+		}
 
-	if err != nil {
-		Fatalf("Failed to read private key contents", "file", ctx.String(PrivateKeyPathFlag.Name), "err", err)
-	}
+		keyPath = ctx.String(MnemonicPathFlag.Name)
+		blob, err := readSecretFile(ctx, keyPath)
 
-	pkey := strings.TrimSpace(string(blob))
+		if err != nil {
+			Fatalf("Failed to read mnemonic contents from %s: %v", keyPath, err)
+		}
 
-	privateKey, err := crypto.HexToECDSA(pkey)
+		privateKey, err = deriveMnemonicKey(string(blob), ctx.String(HDPathFlag.Name), uint32(hdIndex))
 
-	if err != nil {
-		Fatalf("Failed to convert pkey", "err", err)
+		if err != nil {
+			Fatalf("Failed to derive key from mnemonic: %v", err)
+		}
+	} else {
+		if !ctx.IsSet(PrivateKeyPathFlag.Name) {
+			Fatalf("Path to private key file or mnemonic file required")
+		}
+
+		blob, err := readSecretFile(ctx, keyPath)
+
+		if err != nil {
+			Fatalf("Failed to read private key contents from %s: %v", keyPath, err)
+		}
+
+		pkey := strings.TrimSpace(string(blob))
+
+		privateKey, err = crypto.HexToECDSA(pkey)
+
+		if err != nil {
+			Fatalf("Failed to convert pkey: %v", err)
+		}
 	}
 
 	// Create a keystore for the account
@@ -149,21 +235,39 @@ func initOracle(ctx *cli.Context) error {
 	if !ks.HasAddress(account) {
 		_, err = ks.ImportECDSA(privateKey, pass)
 		if err != nil {
-			Fatalf("Failed to import Oracle signer account", "err", err)
+			Fatalf("Failed to import Oracle signer account: %v", err)
 		}
 
-		fmt.Printf("Account %v created. You can now delete %v\n", account.Hex(), ctx.String(PrivateKeyPathFlag.Name))
+		fmt.Printf("Account %v created\n", account.Hex())
 
 	} else {
 		fmt.Printf("Account %v already exists\n", account.Hex())
 	}
 
+	// The mnemonic may be the only backup of other accounts derived from it, so it is never deleted
+	if ctx.IsSet(MnemonicPathFlag.Name) {
+		fmt.Printf("The mnemonic may back up other accounts too, so %v has not been deleted. Move it to offline storage\n", keyPath)
+		return nil
+	}
+
+	// The key is now in the keystore, so the plain text key file is no longer required
+	if ctx.Bool(ShredKeyFlag.Name) || confirm(fmt.Sprintf("Securely overwrite and delete %v?", keyPath)) {
+		if err := shredFile(keyPath); err != nil {
+			Fatalf("Failed to delete %v: %v", keyPath, err)
+		}
+		fmt.Printf("%v overwritten and deleted\n", keyPath)
+	} else {
+		fmt.Printf("You can now delete %v\n", keyPath)
+	}
+
 	return nil
 }
 
 func registerWrkchain(ctx *cli.Context) error {
 
-	fmt.Println()
+	if err := setupLogging(ctx); err != nil {
+		Fatalf("Could not set up logging: %v", err)
+	}
 	ctxBg := context.Background()
 	MkDataDir(ctx.String(DataDirectoryFlag.Name))
 
@@ -189,19 +293,17 @@ func registerWrkchain(ctx *cli.Context) error {
 	genesisHash := block.Header().GoEthereumHash()
 	wrkchainNetworkID := genesis.Config.ChainId
 
-	fmt.Println("Registering WRKChain with:")
-	fmt.Println("WRKChain Genesis Hash:", genesisHash.Hex())
-	fmt.Println("WRKChain Network ID:", wrkchainNetworkID)
+	log.Info("Registering WRKChain", "genesis", genesisHash.Hex(), "chainid", wrkchainNetworkID)
 
 	// Process authorised addresses
 	if !ctx.IsSet(AuthorisedAccountsFlag.Name) {
-		Fatalf("List of Authorised addresses required required")
+		Fatalf("List of Authorised addresses required")
 	}
 
-	thisAccount := common.HexToAddress(strings.TrimSpace(ctx.String(AccountUnlockFlag.Name)))
+	thisAccount := accountFromFlag(ctx)
 
 	// add this account by default
-	fmt.Println("Adding default authorised address:", thisAccount.Hex())
+	log.Info("Adding default authorised address", "address", thisAccount.Hex())
 	authAddresses := []common.Address{thisAccount}
 
 	addressParts := strings.Split(strings.TrimSpace(ctx.String(AuthorisedAccountsFlag.Name)), ",")
@@ -209,11 +311,11 @@ func registerWrkchain(ctx *cli.Context) error {
 	for _, authAddr := range addressParts {
 		authAddr = strings.TrimSpace(authAddr)
 		if !common.IsHexAddress(authAddr) {
-			Fatalf("Invalid address", authAddr)
+			Fatalf("Invalid address %s", authAddr)
 		}
 		authAddr := common.HexToAddress(authAddr)
 		if authAddr != thisAccount {
-			fmt.Println("Adding authorised address:", authAddr.Hex())
+			log.Info("Adding authorised address", "address", authAddr.Hex())
 			authAddresses = append(authAddresses, authAddr)
 		}
 	}
@@ -222,88 +324,83 @@ func registerWrkchain(ctx *cli.Context) error {
 		Fatalf("At least one valid authorised address required")
 	}
 
+	// Create a signer, unless the Tx is to be signed offline
+	var signer Signer
+	if !ctx.IsSet(UnsignedOutFlag.Name) {
+		signer = newSigner(ctxBg, ctx)
+	}
+
 	// Create a new WRKChainRoot Session
-	wrkchainRootSession := NewWrkchainRootSession(ctxBg, ctx)
+	wrkchainRootSession := NewWrkchainRootSession(ctxBg, thisAccount)
 
 	// Connect
-	fmt.Println("Connecting to Mainchain JSON RPC on", ctx.String(MainchainJSONRPCFlag.Name))
-	mainchainClient, err := ethclient.Dial(strings.TrimSpace(ctx.String(MainchainJSONRPCFlag.Name)))
-	if err != nil {
-		Fatalf("Couldn't connect to Mainchain", "err", err)
-	}
+	mainchainClient := connectMainchain(ctx)
+	gas := newGasStrategy(ctx, mainchainClient)
 
 	balance, _ := mainchainClient.BalanceAt(ctxBg, thisAccount, nil)
-	balanceFloat := new(big.Float)
-	balanceFloat.SetString(balance.String())
-	undValue := new(big.Float).Quo(balanceFloat, big.NewFloat(math.Pow10(18)))
-	fmt.Println("Balance for", ctx.String(AccountUnlockFlag.Name), undValue, "UND")
+	undValue := weiToUnd(balance)
+	log.Info("Balance", "account", thisAccount.Hex(), "und", undValue)
 
 	wrkchainRootSession = LoadContract(wrkchainRootSession, mainchainClient)
 
 	// Query RegisterWrkChain event to see if WRKChain has already been registered
-	var filterOpts = new(bind.FilterOpts)
-	filterOpts.Start = 0
-	filterOpts.End = nil
-	filterOpts.Context = ctxBg
-
-	wrkchainIDFilterList := make([]*big.Int, 0)
-	wrkchainIDFilterList = append(wrkchainIDFilterList, wrkchainNetworkID)
-
-	registerWrkChainEvents, err := wrkchainRootSession.Contract.FilterRegisterWrkChain(filterOpts, wrkchainIDFilterList)
+	registration, err := findRegistration(ctxBg, &wrkchainRootSession, wrkchainNetworkID)
 	if err != nil {
-		Fatalf("failed to filter for RegisterWrkChain events:", "err", err)
+		Fatalf("failed to filter for RegisterWrkChain events: %v", err)
 	}
 
-	defer registerWrkChainEvents.Close()
-
-	if registerWrkChainEvents.Next() {
+	if registration != nil {
 		// already registered. Output info and exit
-		fmt.Println("Found WRKChain ID:", registerWrkChainEvents.Event.ChainId.String())
-		fmt.Println("with Genesis Hash", hexutil.Encode(registerWrkChainEvents.Event.GenesisHash[:]))
-		Fatalf("WRKChain already registered in Tx", registerWrkChainEvents.Event.Raw.TxHash.Hex())
+		log.Info("Found WRKChain", "chainid", registration.ChainId, "genesis", hexutil.Encode(registration.GenesisHash[:]))
+		Fatalf("WRKChain already registered in Tx %s", registration.Raw.TxHash.Hex())
 	}
 
 	// gather up params for registering WRKChain
 	// Required deposit amount held in first storage value in WRKChain Root contract
-	deposit, _ := mainchainClient.StorageAt(ctxBg, common.HexToAddress(WRKChainRootContractAddress), common.HexToHash(DepositStorageAddress), nil)
-	depositAmount := big.NewInt(0).SetBytes(deposit)
+	depositAmount, _ := registrationDeposit(ctxBg, mainchainClient)
 
-	fmt.Printf("depositAmount = %s\n", depositAmount.String())
+	log.Info("Registration deposit", "wei", depositAmount)
 
 	totalAmount := big.NewInt(0)
 	totalAmount.Add(depositAmount, calcTax())
 
 	if balance.Cmp(totalAmount) == -1 {
-		Fatalf("Not enough UND to register",
-			"account",
-			ctx.String(AccountUnlockFlag.Name),
-			"balance",
-			undValue.String(),
-			"UND",
-		)
+		Fatalf("Not enough UND to register. Account %s has %v UND, but %v UND is required", thisAccount.Hex(), undValue, weiToUnd(totalAmount))
 	}
 
-	nonce, _ := mainchainClient.PendingNonceAt(ctxBg, thisAccount)
-	fmt.Printf("PendingNonceAt: %v\n", nonce)
+	txm := newTxManager(ctx, mainchainClient, gas, thisAccount, signer)
 
-	wrkchainRootSession.TransactOpts.Value = depositAmount
-	wrkchainRootSession.TransactOpts.Nonce = big.NewInt(int64(nonce))
-	wrkchainRootSession.TransactOpts.GasLimit = 240000 // pseudo gas limit. Never consumed, but used to calculate block gas consumption
+	if ctx.IsSet(UnsignedOutFlag.Name) {
+		tx, err := txm.Build(ctxBg, "registerWrkChain", depositAmount, wrkchainNetworkID, authAddresses, genesisHash)
+		if err != nil {
+			Fatalf("Couldn't build RegisterWrkChain tx: %v", err)
+		}
+		if err := writeUnsignedTx(ctx.String(UnsignedOutFlag.Name), "registerWrkChain", thisAccount, tx, mainchainClient.SigningChainID()); err != nil {
+			Fatalf("Couldn't write unsigned tx: %v", err)
+		}
+		log.Info("Unsigned RegisterWrkChain tx written", "path", ctx.String(UnsignedOutFlag.Name))
+		return nil
+	}
 
-	tx, err := wrkchainRootSession.RegisterWrkChain(wrkchainNetworkID, authAddresses, genesisHash)
+	tx, err := txm.Transact(ctxBg, "registerWrkChain", depositAmount, wrkchainNetworkID, authAddresses, genesisHash)
 
 	if err != nil {
-		Fatalf("Couldn't register WRKChain", "err", err)
+		Fatalf("Couldn't register WRKChain: %v", err)
 	}
 
-	fmt.Println("RegisterWrkChain tx sent:", tx.Hash().Hex())
+	log.Info("RegisterWrkChain tx sent", "tx", tx.Hash().Hex(), "nonce", tx.Nonce())
 
 	return nil
 }
 
 func recordWrkchainBlock(ctx *cli.Context) error {
 
-	fmt.Println()
+	if err := setupLogging(ctx); err != nil {
+		Fatalf("Could not set up logging: %v", err)
+	}
+	if err := setupWebhooks(ctx); err != nil {
+		Fatalf("Could not set up webhooks: %v", err)
+	}
 	ctxBg := context.Background()
 	MkDataDir(ctx.String(DataDirectoryFlag.Name))
 
@@ -311,81 +408,142 @@ func recordWrkchainBlock(ctx *cli.Context) error {
 		Fatalf("WRKChainJSONRPCFlag not set")
 	}
 
-	// Create a new WRKChainRoot Session
-	wrkchainRootSession := NewWrkchainRootSession(ctxBg, ctx)
+	// A recording must succeed within the SLA for the Oracle to be healthy
+	sla := time.Duration(ctx.Int64(HealthSLAFlag.Name)) * time.Second
+	if sla == 0 {
+		sla = 3 * time.Duration(ctx.Int64(WriteFrequencyFlag.Name)) * time.Second
+	}
+	health := newOracleHealth(sla)
 
-	thisAccount := common.HexToAddress(strings.TrimSpace(ctx.String(AccountUnlockFlag.Name)))
+	if ctx.IsSet(MetricsAddrFlag.Name) {
+		if err := startMetricsServer(ctx.String(MetricsAddrFlag.Name), health); err != nil {
+			Fatalf("Could not start metrics server: %v", err)
+		}
+	}
 
-	// Connect
-	fmt.Println("Connecting to Mainchain JSON RPC on", ctx.String(MainchainJSONRPCFlag.Name))
-	mainchainClient, err := ethclient.Dial(strings.TrimSpace(ctx.String(MainchainJSONRPCFlag.Name)))
-	if err != nil {
-		Fatalf("Couldn't connect to Mainchain", "err", err)
+	// Create a signer for each of the Oracle's accounts
+	addresses := accountsFromFlag(ctx)
+	signers := make([]Signer, len(addresses))
+	for i, address := range addresses {
+		signers[i] = newAccountSigner(ctxBg, ctx, address)
 	}
+	health.Unlocked(addresses)
+
+	// Create a new WRKChainRoot Session
+	wrkchainRootSession := NewWrkchainRootSession(ctxBg, addresses[0])
+
+	// Connect
+	mainchainClient := connectMainchain(ctx)
 
 	wrkchainRootSession = LoadContract(wrkchainRootSession, mainchainClient)
 
-	fmt.Println("Connecting to WRKChain JSON RPC on", ctx.String(WRKChainJSONRPCFlag.Name))
-	wrkChainClient, _ := ethclient.Dial(strings.TrimSpace(ctx.String(WRKChainJSONRPCFlag.Name)))
+	go mainchainClient.MonitorHealth(time.Duration(ctx.Int64(MainchainHealthCheckFlag.Name)) * time.Second)
+
+	// Pre-flight checks, so that Txs aren't sent only to be reverted
+	if err := checkWrkchainRootContract(ctxBg, mainchainClient); err != nil {
+		Fatalf("WRKChain Root contract check failed: %v", err)
+	}
+
+	wrkChainRPC, wrkChainClient := connectWrkchain(ctx)
+	health.Connected(mainchainClient, wrkChainClient)
 
-	wrkchainNetworkID, err := wrkChainClient.NetworkID(ctxBg)
+	// Confirm the WRKChain node is the registered WRKChain before recording anything
+	registration, err := verifyWrkchain(ctxBg, wrkChainRPC, wrkChainClient, mainchainClient, &wrkchainRootSession)
 
 	if err != nil {
-		Fatalf("Could not get WRKChain Network ID: ", err)
+		waitNotifiers(webhookExitWait)
+		Fatalf("WRKChain verification failed: %v", err)
+	}
+
+	for _, address := range addresses {
+		if err := checkAuthorised(registration, address); err != nil {
+			waitNotifiers(webhookExitWait)
+			Fatalf("Authorisation check failed: %v", err)
+		}
+	}
+
+	wrkchainNetworkID := registration.ChainID
+	health.Registered(wrkchainNetworkID)
+
+	gas := newGasStrategy(ctx, mainchainClient)
+
+	oracleAccounts := make([]*oracleAccount, len(signers))
+	for i, signer := range signers {
+		txm := newTxManager(ctx, mainchainClient, gas, signer.Account(), signer)
+		go txm.Monitor(txMonitorInterval)
+		oracleAccounts[i] = &oracleAccount{
+			address: signer.Account(),
+			txm:     txm,
+		}
 	}
 
-	pollWrkchain(ctx, mainchainClient, &wrkchainRootSession, wrkChainClient, wrkchainNetworkID, thisAccount)
+	// each account records once every --freq x number of accounts
+	interval := time.Duration(ctx.Int64(WriteFrequencyFlag.Name)*int64(len(oracleAccounts))) * time.Second
+	balances := newBalanceMonitor(ctx, interval)
+	health.Monitoring(balances)
+	treasury := newTreasury(ctx, mainchainClient, gas, addresses, balances)
+
+	pollWrkchain(ctx, newAccountPool(mainchainClient, oracleAccounts, balances, treasury), wrkChainClient, wrkchainNetworkID)
 
 	return nil
 }
 
 func pollWrkchain(
 	ctx *cli.Context,
-	mainchainClient *ethclient.Client,
-	wrkchainRootSession *wrkchainroot.WRKChainRootSession,
+	pool *accountPool,
 	wrkChainClient *ethclient.Client,
 	wrkchainNetworkID *big.Int,
-	thisAccount common.Address,
 ) {
 
-	fmt.Println("Start Polling")
-
 	frequency := ctx.Int64(WriteFrequencyFlag.Name)
+	hooks := newRecordHooks(ctx)
+	budget := newSpendBudget(ctx)
+
+	log.Info("Start polling", "freq", frequency)
+
+	// the WRKChain is stalled while its head does not advance between polls
+	var lastHeight *big.Int
+	stalled := false
 
 	for {
 
-		// get UND Balance
-		balance, _ := mainchainClient.BalanceAt(context.Background(), thisAccount, nil)
-
-		balanceFloat := new(big.Float)
-		balanceFloat.SetString(balance.String())
-		undValue := new(big.Float).Quo(balanceFloat, big.NewFloat(math.Pow10(18)))
-		fmt.Println("Balance for", thisAccount.Hex(), undValue, "UND")
-
-		if balance.Cmp(calcTax()) == -1 {
-			Fatalf("Not enough UND to record",
-				"account",
-				ctx.String(AccountUnlockFlag.Name),
-				"balance",
-				undValue.String(),
-				"UND",
-			)
+		// the interval is stretched as a budget nears its limit, and recording pauses once it's spent
+		interval, paused := budget.Next(time.Duration(frequency) * time.Second)
+		if paused {
+			<-time.After(interval)
+			continue
 		}
 
-		nonce, _ := mainchainClient.PendingNonceAt(context.Background(), thisAccount)
-		fmt.Printf("PendingNonceAt: %v\n", nonce)
-		fmt.Printf("lastPendingNonce: %v\n", lastPendingNonce)
-		if nonce == lastPendingNonce {
-			nonce++
+		// pick the next account with enough UND, and no stuck Txs
+		acc, err := pool.Next(context.Background())
+
+		if err != nil {
+			log.Error("Could not record WRKChain header", "err", err, "retry", time.Duration(frequency)*time.Second)
+			<-time.After(time.Duration(frequency) * time.Second)
+			continue
 		}
-		lastPendingNonce = nonce
 
+		start := time.Now()
 		latestWrkchainHeader, err := wrkChainClient.HeaderByNumber(context.Background(), nil)
+		metrics.ObserveRPC(ChainWrkchain, "HeaderByNumber", start, err)
 
 		if err != nil {
-			Fatalf("Could not get latest WRKChain Block: ", err)
+			Fatalf("Could not get latest WRKChain Block: %v", err)
 		}
 
+		metrics.SetWrkchainHeight(latestWrkchainHeader.Number)
+
+		switch {
+		case lastHeight != nil && latestWrkchainHeader.Number.Cmp(lastHeight) <= 0 && !stalled:
+			stalled = true
+			log.Warn("WRKChain head has not advanced since the last poll", "height", latestWrkchainHeader.Number, "since", time.Duration(frequency)*time.Second)
+			notify(EventWrkchainStalled, "WRKChain head has not advanced since the last poll", "chainid", wrkchainNetworkID, "height", latestWrkchainHeader.Number)
+		case lastHeight != nil && latestWrkchainHeader.Number.Cmp(lastHeight) > 0 && stalled:
+			stalled = false
+			log.Info("WRKChain head advancing again", "height", latestWrkchainHeader.Number)
+		}
+		lastHeight = latestWrkchainHeader.Number
+
 		blockHash := latestWrkchainHeader.GoEthereumHash()
 		parentHash := [32]byte{0}
 		receiptHash := [32]byte{0}
@@ -409,7 +567,10 @@ func pollWrkchain(
 			rootHash = latestWrkchainHeader.Root
 		}
 		go record(
-			wrkchainRootSession,
+			acc.txm,
+			pool.balances,
+			hooks,
+			budget,
 			wrkchainNetworkID,
 			blockHeight,
 			blockHash,
@@ -417,17 +578,18 @@ func pollWrkchain(
 			receiptHash,
 			txHash,
 			rootHash,
-			thisAccount,
-			frequency,
-			nonce)
+			acc.address)
 
-		<-time.After(time.Duration(frequency) * time.Second)
+		<-time.After(interval)
 	}
 
 }
 
 func record(
-	wrkchainRootSession *wrkchainroot.WRKChainRootSession,
+	txm *txManager,
+	balances *balanceMonitor,
+	hooks *recordHooks,
+	budget *spendBudget,
 	wrkchainNetworkID *big.Int,
 	blockHeight *big.Int,
 	blockHash [32]byte,
@@ -435,99 +597,82 @@ func record(
 	receiptHash [32]byte,
 	txHash [32]byte,
 	rootHash [32]byte,
-	sealer common.Address,
-	frequency int64,
-	nonce uint64) {
-
-	fmt.Println("WRKChain Network ID:", wrkchainNetworkID)
-	fmt.Println("blockHeight", blockHeight)
-	fmt.Println("blockHash", common.ToHex(blockHash[:]))
-	fmt.Println("parentHash", common.ToHex(parentHash[:]))
-	fmt.Println("receiptHash", common.ToHex(receiptHash[:]))
-	fmt.Println("txHash", common.ToHex(txHash[:]))
-	fmt.Println("rootHash", common.ToHex(rootHash[:]))
-	fmt.Println("sealer", sealer.Hex())
-	fmt.Println("nonce", nonce)
-
-	fmt.Println("Sending Tx to WRKChain Root on Mainchain")
+	sealer common.Address) {
 
-	wrkchainRootSession.TransactOpts.Value = big.NewInt(0)
-	wrkchainRootSession.TransactOpts.Nonce = big.NewInt(int64(nonce))
-	wrkchainRootSession.TransactOpts.GasLimit = 240000 // pseudo gas limit. Never consumed, but used to calculate block gas consumption
-
-	tx, err := wrkchainRootSession.RecordHeader(wrkchainNetworkID, blockHeight, blockHash, parentHash, receiptHash, txHash, rootHash, sealer)
-
-	if err != nil {
-		Fatalf("Could not record WRKChain Header:", err)
+	// a recording is logged as a single event
+	fields := []interface{}{
+		"chainid", wrkchainNetworkID,
+		"height", blockHeight,
+		"hash", common.ToHex(blockHash[:]),
+		"parent", common.ToHex(parentHash[:]),
+		"receipt", common.ToHex(receiptHash[:]),
+		"txroot", common.ToHex(txHash[:]),
+		"stateroot", common.ToHex(rootHash[:]),
+		"sealer", sealer.Hex(),
 	}
 
-	fmt.Println("RecordHeader tx sent:", tx.Hash().Hex())
-
-	// ToDo: Check tx receipt for success/failure and report
-
-	fmt.Println("Waiting for", frequency, "seconds")
-	fmt.Println("-------------------------------------")
-
-}
+	header := &hookHeader{
+		ChainID:   wrkchainNetworkID,
+		Height:    blockHeight,
+		Hash:      common.ToHex(blockHash[:]),
+		Parent:    common.ToHex(parentHash[:]),
+		Receipt:   common.ToHex(receiptHash[:]),
+		TxRoot:    common.ToHex(txHash[:]),
+		StateRoot: common.ToHex(rootHash[:]),
+		Sealer:    sealer.Hex(),
+	}
 
-// NewWrkchainRootSession Create a new session for the WRKChain Root smart contract
-func NewWrkchainRootSession(bgCtx context.Context, ctx *cli.Context) (session wrkchainroot.WRKChainRootSession) {
-	// Grab the password
-	if !ctx.IsSet(PasswordPathFlag.Name) {
-		Fatalf("Path to password file required")
+	failed := func(err error) {
+		log.Error("Could not record WRKChain header", append(fields, "err", err)...)
+		notify(EventRecordingFailed, "Could not record WRKChain header", append(fields, "err", err.Error())...)
+		hooks.Post(header, nil, err)
 	}
 
-	blob, err := ioutil.ReadFile(ctx.String(PasswordPathFlag.Name))
+	// the Tx is built first, so that the pre-submit hook is given the nonce, gas and gas price it
+	// will be sent with
+	tx, err := txm.Build(context.Background(), "recordHeader", big.NewInt(0), wrkchainNetworkID, blockHeight, blockHash, parentHash, receiptHash, txHash, rootHash, sealer)
 
 	if err != nil {
-		Fatalf("Failed to read account password contents", "file", ctx.String(PasswordPathFlag.Name), "err", err)
-	}
-	pass := strings.TrimSpace(string(blob))
-
-	// grab account to unlock
-	if !ctx.IsSet(AccountUnlockFlag.Name) {
-		Fatalf("Account to unlock required")
+		failed(err)
+		return
 	}
 
-	account := strings.TrimSpace(ctx.String(AccountUnlockFlag.Name))
-	if !common.IsHexAddress(account) {
-		Fatalf("Account not in common hex format, e.g. 0xabd123...")
+	// the pre-submit hook can veto the recording
+	if err := hooks.Pre(header, newHookTx(tx, txm.account)); err != nil {
+		log.Warn("Recording vetoed by pre-submit hook", append(fields, "err", err)...)
+		return
 	}
-	acc := accounts.Account{Address: common.HexToAddress(account)}
 
-	ks := keystore.NewKeyStore(filepath.Join(ctx.String(DataDirectoryFlag.Name), "keys"), keystore.StandardScryptN, keystore.StandardScryptP)
+	tx, err = txm.Send(context.Background(), "recordHeader", tx)
 
-	thisAcc, err := ks.Find(acc)
 	if err != nil {
-		Fatalf("Could not find account. Did you init first?: ", "err", err)
+		failed(err)
+		return
 	}
 
-	keystore, err := os.Open(thisAcc.URL.Path)
-	if err != nil {
-		Fatalf("Couldn't read Keystore", "err", err)
-	}
-	defer keystore.Close()
+	// the Tx manager reports whether the Tx was mined or reverted
+	log.Info("Recorded WRKChain header", append(fields, "tx", tx.Hash().Hex(), "nonce", tx.Nonce())...)
 
-	auth, err := bind.NewTransactor(keystore, pass)
-	if err != nil {
-		Fatalf("Couldn't bind transactor", "err", err)
-	}
+	maxFee := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.Gas()))
+	balances.RecordedFee(maxFee)
+	budget.Spent(new(big.Int).Add(calcTax(), maxFee))
 
-	fmt.Printf("auth.From: %v\n", auth.From.Hex())
+	hooks.Post(header, newHookTx(tx, txm.account), nil)
+}
 
+// NewWrkchainRootSession Create a new session for the WRKChain Root smart contract
+func NewWrkchainRootSession(bgCtx context.Context, account common.Address) (session wrkchainroot.WRKChainRootSession) {
 	return wrkchainroot.WRKChainRootSession{
-		TransactOpts: *auth,
 		CallOpts: bind.CallOpts{
 			Pending: true,
-			From:    auth.From,
+			From:    account,
 			Context: bgCtx,
 		},
 	}
-
 }
 
 // LoadContract Load the WRKChain Root smart contract into the WRKChain Root Session
-func LoadContract(session wrkchainroot.WRKChainRootSession, client *ethclient.Client) wrkchainroot.WRKChainRootSession {
+func LoadContract(session wrkchainroot.WRKChainRootSession, client bind.ContractBackend) wrkchainroot.WRKChainRootSession {
 	addr := common.HexToAddress(WRKChainRootContractAddress)
 	instance, err := wrkchainroot.NewWRKChainRoot(addr, client)
 	if err != nil {
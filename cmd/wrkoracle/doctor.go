@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/unification-com/mainchain/accounts"
+	"github.com/unification-com/mainchain/accounts/abi/bind"
+	"github.com/unification-com/mainchain/accounts/keystore"
+	"github.com/unification-com/mainchain/common"
+	wrkchainroot "github.com/unification-com/mainchain/contracts/wrkchainroot/contract"
+	"github.com/unification-com/mainchain/ethclient"
+	"github.com/unification-com/mainchain/rpc"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+)
+
+var (
+	doctorCommand = cli.Command{
+		Action:    runDoctor,
+		Name:      "doctor",
+		Usage:     "Diagnose the Oracle setup",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			AccountUnlockFlag,
+			PasswordPathFlag,
+			PasswordFDFlag,
+			StrictPermsFlag,
+			SignerFlag,
+			DataDirectoryFlag,
+			MainchainJSONRPCFlag,
+			MainchainMaxHeadDriftFlag,
+			MainchainChainIDFlag,
+			UndTestnetFlag,
+			WRKChainJSONRPCFlag,
+		},
+		Category: "ORACLE COMMANDS",
+		Description: `
+The doctor command checks the Oracle setup end to end, in the order the register and record
+commands depend on it, and outputs a pass or fail checklist with hints to fix each failure.
+Checks which depend on an earlier failed check are skipped.`,
+	}
+
+	// errSkipped returned by a doctor check which could not run because an earlier check failed
+	errSkipped = errors.New("skipped")
+)
+
+// doctorCheck a single diagnostic check, with a hint to fix it should it fail
+type doctorCheck struct {
+	name string
+	hint string
+	run  func() error
+}
+
+// doctor state shared between checks, populated as each check passes
+type doctor struct {
+	ctx             *cli.Context
+	bgCtx           context.Context
+	account         common.Address
+	keyFile         string
+	mainchainClient *MainchainClient
+	session         *wrkchainroot.WRKChainRootSession
+	registration    *wrkchainRegistration
+	balance         *big.Int
+}
+
+func runDoctor(ctx *cli.Context) error {
+
+	d := &doctor{
+		ctx:   ctx,
+		bgCtx: context.Background(),
+	}
+
+	checks := []doctorCheck{
+		{
+			name: "Data directory permissions",
+			hint: "Run the init command, or check --datadir exists and is only accessible by the user running the Oracle, e.g. chmod 700 [datadir]",
+			run:  d.checkDataDir,
+		},
+		{
+			name: "Keystore or --signer holds --account",
+			hint: "Run the init command to import the account's private key, or check --account and --datadir are correct. With --signer, check the external signer is running and manages --account",
+			run:  d.checkKeystore,
+		},
+		{
+			name: "Password decrypts key",
+			hint: "Check --password, --password-fd or WRKORACLE_PASSWORD supplies the password used when the init command was run, and that the password file is only readable by its owner, e.g. chmod 600 [password file]",
+			run:  d.checkPassword,
+		},
+		{
+			name: "Mainchain connectivity and chain ID",
+			hint: "Check each --mainchain.rpc URL is correct and reachable, and all point to the network set by --mainchain.chainid",
+			run:  d.checkMainchain,
+		},
+		{
+			name: "WRKChain Root contract",
+			hint: "Check --mainchain.rpc points to a UND Mainchain node, and not a WRKChain or other network",
+			run:  d.checkContract,
+		},
+		{
+			name: "WRKChain connectivity and registration",
+			hint: "Check --wrkchain.rpc points to your WRKChain, and that it has been registered with the register command",
+			run:  d.checkWrkchain,
+		},
+		{
+			name: "Balance covers the next Tx",
+			hint: "Fund --account with UND. Registration requires the deposit plus tax and gas, and each recording costs the tax plus gas",
+			run:  d.checkBalance,
+		},
+		{
+			name: "WRKChain authorisation at registration",
+			hint: "Run the record command with one of the WRKChain's authorised accounts as --account. Only the accounts authorised by the registration Tx are checked, not authorisations changed since",
+			run:  d.checkAuthorisation,
+		},
+	}
+
+	fmt.Println()
+	fmt.Println("WRKChain Oracle doctor")
+	fmt.Println("-------------------------------------")
+
+	failed := 0
+	for i, check := range checks {
+		err := check.run()
+		switch err {
+		case nil:
+			fmt.Printf("[PASS] %d. %s\n", i+1, check.name)
+		case errSkipped:
+			fmt.Printf("[SKIP] %d. %s\n", i+1, check.name)
+		default:
+			failed++
+			fmt.Printf("[FAIL] %d. %s: %v\n", i+1, check.name, err)
+			fmt.Printf("       Hint: %s\n", check.hint)
+		}
+	}
+
+	fmt.Println("-------------------------------------")
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+func (d *doctor) checkDataDir() error {
+	dataDir := d.ctx.String(DataDirectoryFlag.Name)
+	info, err := os.Stat(dataDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dataDir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s has permissions %v, and is accessible by other users", dataDir, info.Mode().Perm())
+	}
+
+	tmpFile, err := ioutil.TempFile(dataDir, ".doctor")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %v", dataDir, err)
+	}
+	tmpFile.Close()
+	return os.Remove(tmpFile.Name())
+}
+
+func (d *doctor) checkKeystore() error {
+	account, err := parseAccountFlag(d.ctx)
+	if err != nil {
+		return err
+	}
+	d.account = account
+
+	// the external signer holds the key, so there is no key file to decrypt
+	if d.ctx.IsSet(SignerFlag.Name) {
+		_, err := dialExternalSigner(d.bgCtx, d.ctx.String(SignerFlag.Name), d.account)
+		return err
+	}
+
+	acc, err := openKeystore(d.ctx).Find(accounts.Account{Address: d.account})
+	if err != nil {
+		return fmt.Errorf("%s: %v", d.account.Hex(), err)
+	}
+	d.keyFile = acc.URL.Path
+	return nil
+}
+
+func (d *doctor) checkPassword() error {
+	if d.keyFile == "" {
+		return errSkipped
+	}
+	pass, err := readPassword(d.ctx, false)
+	if err != nil {
+		return err
+	}
+	keyJSON, err := ioutil.ReadFile(d.keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := keystore.DecryptKey(keyJSON, pass)
+	if err != nil {
+		return err
+	}
+	if key.Address != d.account {
+		return fmt.Errorf("key file %s contains %s", d.keyFile, key.Address.Hex())
+	}
+	return nil
+}
+
+func (d *doctor) checkMainchain() error {
+	mainchainClient, err := DialMainchain(mainchainRPCURLs(d.ctx))
+	if err != nil {
+		return err
+	}
+	if err := mainchainClient.CheckConsistency(d.bgCtx, d.ctx.Uint64(MainchainMaxHeadDriftFlag.Name)); err != nil {
+		return err
+	}
+	expected, source := expectedChainID(d.ctx)
+	chainID, err := mainchainClient.VerifyChainID(d.bgCtx, expected, source)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Mainchain chain ID:", chainID)
+
+	d.mainchainClient = mainchainClient
+	return nil
+}
+
+func (d *doctor) checkContract() error {
+	if d.mainchainClient == nil {
+		return errSkipped
+	}
+	if err := checkWrkchainRootContract(d.bgCtx, d.mainchainClient); err != nil {
+		return err
+	}
+
+	instance, err := wrkchainroot.NewWRKChainRoot(common.HexToAddress(WRKChainRootContractAddress), d.mainchainClient)
+	if err != nil {
+		return err
+	}
+	d.session = &wrkchainroot.WRKChainRootSession{
+		Contract: instance,
+		CallOpts: bind.CallOpts{
+			Pending: true,
+			From:    d.account,
+			Context: d.bgCtx,
+		},
+	}
+	return nil
+}
+
+func (d *doctor) checkBalance() error {
+	if d.mainchainClient == nil || d.account == (common.Address{}) {
+		return errSkipped
+	}
+	balance, err := d.mainchainClient.BalanceAt(d.bgCtx, d.account, nil)
+	if err != nil {
+		return err
+	}
+	gasPrice, err := d.mainchainClient.SuggestGasPrice(d.bgCtx)
+	if err != nil {
+		return err
+	}
+	d.balance = balance
+
+	gas := new(big.Int).Mul(new(big.Int).SetUint64(recordHeaderGasEstimate), gasPrice)
+	required := new(big.Int).Add(calcTax(), gas)
+
+	// once the WRKChain is registered, the account only needs to pay for the next recording
+	if d.registration != nil {
+		fmt.Println("Balance for", d.account.Hex(), weiToUnd(balance), "UND. Tax", weiToUnd(calcTax()), "UND, gas", weiToUnd(gas), "UND")
+		if balance.Cmp(required) == -1 {
+			return fmt.Errorf("balance %v UND is less than tax + gas %v UND", weiToUnd(balance), weiToUnd(required))
+		}
+		return nil
+	}
+
+	deposit, err := registrationDeposit(d.bgCtx, d.mainchainClient)
+	if err != nil {
+		return err
+	}
+	required.Add(required, deposit)
+	fmt.Println("Balance for", d.account.Hex(), weiToUnd(balance), "UND. Deposit", weiToUnd(deposit), "UND, tax", weiToUnd(calcTax()), "UND, gas", weiToUnd(gas), "UND")
+
+	if balance.Cmp(required) == -1 {
+		return fmt.Errorf("balance %v UND is less than deposit + tax + gas %v UND", weiToUnd(balance), weiToUnd(required))
+	}
+	return nil
+}
+
+func (d *doctor) checkWrkchain() error {
+	if d.session == nil {
+		return errSkipped
+	}
+	if !d.ctx.IsSet(WRKChainJSONRPCFlag.Name) {
+		return errors.New("--wrkchain.rpc not set")
+	}
+	wrkChainRPC, err := rpc.Dial(strings.TrimSpace(d.ctx.String(WRKChainJSONRPCFlag.Name)))
+	if err != nil {
+		return err
+	}
+	registration, err := verifyWrkchain(d.bgCtx, wrkChainRPC, ethclient.NewClient(wrkChainRPC), d.mainchainClient, d.session)
+	if err != nil {
+		return err
+	}
+	d.registration = registration
+	return nil
+}
+
+func (d *doctor) checkAuthorisation() error {
+	if d.registration == nil || d.account == (common.Address{}) {
+		return errSkipped
+	}
+	return checkAuthorised(d.registration, d.account)
+}
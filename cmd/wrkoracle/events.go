@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+EventRecordingConfirmed: a recordHeader Tx was mined successfully
+EventRecordingFailed: a recordHeader Tx could not be sent, or was reverted
+EventLowBalance: an Oracle account's balance fell below the low balance threshold
+EventWrkchainStalled: the WRKChain's head did not advance between polls
+EventNonceStuck: a Tx was pending for longer than --tx.stuck, and is being replaced
+EventGenesisMismatch: the WRKChain node's IDs or genesis hash do not match the registration
+EventAuthMismatch: an Oracle account is not authorised to record for the WRKChain
+EventTopUp: an Oracle account was topped up from the treasury
+EventTopUpFailed: an Oracle account could not be topped up from the treasury
+EventBudgetExhausted: a recording budget can't pay for another recording, and recording is paused
+EventTest: a test event, sent by the webhook command
+*/
+const (
+	EventRecordingConfirmed = "recording_confirmed"
+	EventRecordingFailed    = "recording_failed"
+	EventLowBalance         = "low_balance"
+	EventWrkchainStalled    = "wrkchain_stalled"
+	EventNonceStuck         = "nonce_stuck"
+	EventGenesisMismatch    = "genesis_mismatch"
+	EventAuthMismatch       = "authorisation_mismatch"
+	EventTopUp              = "treasury_topup"
+	EventTopUpFailed        = "treasury_topup_failed"
+	EventBudgetExhausted    = "budget_exhausted"
+	EventTest               = "test"
+)
+
+// eventTypes every event type, for validating event filters
+var eventTypes = []string{
+	EventRecordingConfirmed,
+	EventRecordingFailed,
+	EventLowBalance,
+	EventWrkchainStalled,
+	EventNonceStuck,
+	EventGenesisMismatch,
+	EventAuthMismatch,
+	EventTopUp,
+	EventTopUpFailed,
+	EventBudgetExhausted,
+	EventTest,
+}
+
+// oracleEvent an event notification hooks are called with
+type oracleEvent struct {
+	Type    string                 `json:"type"`
+	Time    time.Time              `json:"time"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// notifier a notification hook, called with each event the Oracle raises
+type notifier interface {
+	Notify(event *oracleEvent)
+}
+
+var (
+	notifiersMu sync.RWMutex
+	notifiers   []notifier
+	// notifying notification hooks still running, so that they can finish before the Oracle exits
+	notifying sync.WaitGroup
+)
+
+// addNotifier register a notification hook
+func addNotifier(n notifier) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers = append(notifiers, n)
+}
+
+// notify call each notification hook with the event, without waiting for them. fields are key/value
+// pairs, as for log events
+func notify(eventType string, message string, fields ...interface{}) {
+	event := &oracleEvent{
+		Type:    eventType,
+		Time:    time.Now().UTC(),
+		Message: message,
+		Fields:  make(map[string]interface{}),
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		if s, ok := fields[i+1].(fmt.Stringer); ok {
+			event.Fields[key] = s.String()
+		} else {
+			event.Fields[key] = fields[i+1]
+		}
+	}
+
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+	for _, n := range notifiers {
+		notifying.Add(1)
+		go func(n notifier) {
+			defer notifying.Done()
+			n.Notify(event)
+		}(n)
+	}
+}
+
+// waitNotifiers wait up to timeout for running notification hooks to finish. Called before the
+// Oracle exits, so that the event explaining why is delivered
+func waitNotifiers(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		notifying.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+)
+
+// lockFile create the file if it does not exist. Files are not locked on Windows, so only one
+// process should use the data directory at a time. Returns a function to release the lock
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		f.Close()
+	}, nil
+}
@@ -60,16 +60,33 @@ var (
 		Usage: "Directory for the keystore and data",
 		Value: DirectoryString{DefaultDataDir()},
 	}
-	// MainchainJSONRPCFlag Mainchain JSON RPC endpoint
+	// MainchainJSONRPCFlag Mainchain JSON RPC endpoints, in priority order
 	MainchainJSONRPCFlag = cli.StringFlag{
 		Name:  "mainchain.rpc",
-		Usage: "Mainchain JSON RPC endpoint",
+		Usage: "Comma separated list of Mainchain JSON RPC endpoints, in priority order. No spaces. E.g.: http://localhost:8101,https://rpc-testnet.unification.io",
 		Value: DefaultMainchainTestnetRPC,
 	}
+	// MainchainHealthCheckFlag Interval between Mainchain JSON RPC endpoint health checks, in seconds
+	MainchainHealthCheckFlag = cli.IntFlag{
+		Name:  "mainchain.healthcheck",
+		Usage: "Interval between Mainchain JSON RPC endpoint health checks, in seconds. Default 30",
+		Value: 30,
+	}
+	// MainchainMaxHeadDriftFlag Maximum difference in head height between Mainchain JSON RPC endpoints
+	MainchainMaxHeadDriftFlag = cli.Uint64Flag{
+		Name:  "mainchain.maxdrift",
+		Usage: "Maximum difference in head height, in blocks, allowed between Mainchain JSON RPC endpoints. Default 10",
+		Value: 10,
+	}
+	// MainchainChainIDFlag Mainchain chain ID used to sign Txs
+	MainchainChainIDFlag = cli.Uint64Flag{
+		Name:  "mainchain.chainid",
+		Usage: "Mainchain chain ID used to sign Txs. Must match the chain ID reported by --mainchain.rpc. Default 50005 with --und-testnet, otherwise the reported chain ID is used",
+	}
 	// UndTestnetFlag configure for und test network
 	UndTestnetFlag = cli.BoolFlag{
 		Name:  "und-testnet",
-		Usage: "configure for und test network",
+		Usage: "configure for und test network. Mainchain must report the testnet chain ID 50005. The default --mainchain.rpc is a testnet endpoint",
 	}
 
 	// Registration flags
@@ -85,22 +102,260 @@ var (
 		Usage: "Comma separated list of addresses authorised to write to the WRKChain Root smart contract. No spaces. E.g.: 0x160B51e66e51327ac31C643f7675B8A9006aEE1E,0xbEc4127468c51fF89719DBcA5DC57F39C0049f06",
 	}
 
+	// UnsignedOutFlag Path to write the unsigned RegisterWrkChain Tx to, instead of signing and sending it
+	UnsignedOutFlag = cli.StringFlag{
+		Name:  "unsigned-out",
+		Usage: "Path to write the unsigned RegisterWrkChain Tx to, for signing offline with the sign command. If set, the Tx is not signed or sent, and --password is not required. E.g. /path/to/tx.json",
+	}
+	// SignedOutFlag Path to write the signed Tx to
+	SignedOutFlag = cli.StringFlag{
+		Name:  "signed-out",
+		Usage: "Path to write the signed Tx to, for sending with the broadcast command. Defaults to the unsigned Tx's path, with a .signed extension",
+	}
+
 	// Account flags
 
 	// PasswordPathFlag Full path to the account password file
 	PasswordPathFlag = cli.StringFlag{
 		Name:  "password",
-		Usage: "Full path to the account password file. E.g. /path/to/.password",
+		Usage: "Full path to the account password file. E.g. /path/to/.password. With several --account, every account's key must decrypt with this one password",
+	}
+	// PasswordFDFlag File descriptor to read the account password from
+	PasswordFDFlag = cli.IntFlag{
+		Name:  "password-fd",
+		Usage: "File descriptor to read the account password from, instead of --password. E.g. 3. As with --password, one password is used for every --account",
+	}
+	// StrictPermsFlag Refuse to read password, key and mnemonic files readable by group or others
+	StrictPermsFlag = cli.BoolFlag{
+		Name:  "strict-perms",
+		Usage: "Refuse to read password, key and mnemonic files which are readable by group or others, instead of outputting a warning",
+	}
+	// ShredKeyFlag Securely overwrite and delete the private key file once imported
+	ShredKeyFlag = cli.BoolFlag{
+		Name:  "shred",
+		Usage: "Securely overwrite and delete the --key file once it has been imported, without asking. The --mnemonic-file file is never deleted",
+	}
+	// NewPasswordPathFlag Full path to the account's new password file
+	NewPasswordPathFlag = cli.StringFlag{
+		Name:  "new-password",
+		Usage: "Full path to the account's new password file. E.g. /path/to/.new_password",
 	}
 	// PrivateKeyPathFlag Full path to the private key file
 	PrivateKeyPathFlag = cli.StringFlag{
 		Name:  "key",
 		Usage: "Full path to the private key file. E.g. /path/to/.private_key",
 	}
+	// MnemonicPathFlag Full path to the BIP-39 mnemonic file
+	MnemonicPathFlag = cli.StringFlag{
+		Name:  "mnemonic-file",
+		Usage: "Full path to a file containing a BIP-39 mnemonic to derive the private key from, instead of --key. E.g. /path/to/.mnemonic",
+	}
+	// HDPathFlag BIP-44 derivation path the account index is appended to
+	HDPathFlag = cli.StringFlag{
+		Name:  "hd.path",
+		Usage: "BIP-44 derivation path used with --mnemonic-file, to which --hd.index is appended",
+		Value: DefaultHDPath,
+	}
+	// HDIndexFlag Index of the account derived from the mnemonic
+	HDIndexFlag = cli.Uint64Flag{
+		Name:  "hd.index",
+		Usage: "Index of the account derived from --mnemonic-file. Must be less than 2147483648 (hardened indexes are not supported). Default 0",
+	}
+	// BackupSharesFlag Number of shares the keystore backup is split into
+	BackupSharesFlag = cli.IntFlag{
+		Name:  "shares",
+		Usage: "Number of shares account backup splits the encrypted key into. Default 5",
+		Value: 5,
+	}
+	// BackupThresholdFlag Number of shares required to recover the keystore backup
+	BackupThresholdFlag = cli.IntFlag{
+		Name:  "threshold",
+		Usage: "Number of shares required to recover the key from an account backup. Default 3",
+		Value: 3,
+	}
 	// AccountUnlockFlag Account to unlock
 	AccountUnlockFlag = cli.StringFlag{
 		Name:  "account",
-		Usage: "Account to unlock - will be used tp write to the WRKChain Root smart contract when register and record commands are run. E.g. 0x160B51e66e51327ac31C643f7675B8A9006aEE1E",
+		Usage: "Account to unlock - will be used tp write to the WRKChain Root smart contract when register and record commands are run. E.g. 0x160B51e66e51327ac31C643f7675B8A9006aEE1E. The record command accepts a comma separated list of authorised accounts, and rotates Txs across them. Each account's key must decrypt with the same password",
+	}
+
+	// SignerFlag External signer JSON RPC endpoint
+	SignerFlag = cli.StringFlag{
+		Name:  "signer",
+		Usage: "External signer JSON RPC endpoint, either the path to its IPC socket or an HTTP URL, e.g. /path/to/clef.ipc. If set, the keystore and --password are not used",
+	}
+
+	// Policy flags
+
+	// PolicyMaxGasPriceFlag Maximum gas price the signing policy allows, in wei
+	PolicyMaxGasPriceFlag = cli.Uint64Flag{
+		Name:  "policy.gas.price.max",
+		Usage: "Maximum gas price, in wei, the signing policy allows the account to sign. Default 500000000000 (500 Gwei)",
+		Value: 500000000000,
+	}
+	// PolicyDailySpendFlag Maximum UND the signing policy allows to be spent per day
+	PolicyDailySpendFlag = cli.StringFlag{
+		Name:  "policy.spend.daily",
+		Usage: "Maximum UND, including fees and tax, the signing policy allows the account to spend per UTC day. Each recording spends the 1 UND tax plus fees, so allow for 86400 / --freq recordings. Default 0 (no maximum)",
+		Value: "0",
+	}
+
+	// Gas flags
+
+	// GasMarginFlag Safety margin added to the estimated gas limit, in percent
+	GasMarginFlag = cli.Uint64Flag{
+		Name:  "gas.margin",
+		Usage: "Safety margin added to the estimated gas limit of each Tx, in percent. Default 20",
+		Value: 20,
+	}
+	// GasPriceStrategyFlag Strategy used to select the gas price
+	GasPriceStrategyFlag = cli.StringFlag{
+		Name:  "gas.price.strategy",
+		Usage: "Strategy used to select the gas price. One of suggested (the Mainchain node's suggested price), fixed (--gas.price), or percentile (a percentile of prices paid in recent blocks). Default suggested",
+		Value: GasPriceStrategySuggested,
+	}
+	// GasPriceFlag Gas price for the fixed strategy, in wei
+	GasPriceFlag = cli.Uint64Flag{
+		Name:  "gas.price",
+		Usage: "Gas price, in wei, used by the fixed gas price strategy",
+	}
+	// GasPricePercentileFlag Percentile of recent gas prices used by the percentile strategy
+	GasPricePercentileFlag = cli.Uint64Flag{
+		Name:  "gas.price.percentile",
+		Usage: "Percentile of gas prices paid in recent blocks, used by the percentile gas price strategy. Default 60",
+		Value: 60,
+	}
+	// GasPriceBlocksFlag Number of recent blocks sampled by the percentile strategy
+	GasPriceBlocksFlag = cli.Uint64Flag{
+		Name:  "gas.price.blocks",
+		Usage: "Number of recent blocks sampled by the percentile gas price strategy. Default 20",
+		Value: 20,
+	}
+	// GasPriceMaxFlag Maximum gas price, in wei
+	GasPriceMaxFlag = cli.Uint64Flag{
+		Name:  "gas.price.max",
+		Usage: "Maximum gas price, in wei. 0 for no maximum. Default 100000000000 (100 Gwei)",
+		Value: 100000000000,
+	}
+
+	// Tx flags
+
+	// TxStuckTimeoutFlag Time a Tx may be pending before it is replaced with a higher gas price, in seconds
+	TxStuckTimeoutFlag = cli.Int64Flag{
+		Name:  "tx.stuck",
+		Usage: "Time a Tx may be pending before it is replaced with a higher gas price, in seconds. Default 300",
+		Value: 300,
+	}
+	// TxGasBumpFlag Percentage the gas price is increased by when replacing a Tx
+	TxGasBumpFlag = cli.Uint64Flag{
+		Name:  "tx.bump",
+		Usage: "Percentage the gas price is increased by when replacing a Tx. Must be at least 10. Default 15",
+		Value: 15,
+	}
+	// TxNonceFlag Nonce of the Tx to manage
+	TxNonceFlag = cli.Uint64Flag{
+		Name:  "nonce",
+		Usage: "Nonce of the Tx",
+	}
+
+	// Balance flags
+
+	// BalanceWarnRecordingsFlag Warn when the balance pays for fewer than this many recordings
+	BalanceWarnRecordingsFlag = cli.Uint64Flag{
+		Name:  "balance.warn.recordings",
+		Usage: "Warn when an account's balance pays for fewer than this many recordings, at the WRKChain Root tax plus Tx fee each. 0 to disable. Default 24",
+		Value: 24,
+	}
+	// BalanceWarnUndFlag Warn when the balance is below this amount of UND
+	BalanceWarnUndFlag = cli.StringFlag{
+		Name:  "balance.warn.und",
+		Usage: "Warn when an account's balance is below this amount of UND, e.g. 50. 0 to disable. Default 0",
+		Value: "0",
+	}
+
+	// Budget flags
+
+	// BudgetDailyFlag Maximum UND spent recording per UTC day
+	BudgetDailyFlag = cli.StringFlag{
+		Name:  "budget.daily",
+		Usage: "Maximum UND spent recording per UTC day, e.g. 30. 0 for no budget. Default 0",
+		Value: "0",
+	}
+	// BudgetMonthlyFlag Maximum UND spent recording per UTC calendar month
+	BudgetMonthlyFlag = cli.StringFlag{
+		Name:  "budget.monthly",
+		Usage: "Maximum UND spent recording per UTC calendar month, e.g. 700. 0 for no budget. Default 0",
+		Value: "0",
+	}
+	// BudgetStretchFlag Percentage of a budget spent before the recording interval is stretched
+	BudgetStretchFlag = cli.Uint64Flag{
+		Name:  "budget.stretch",
+		Usage: "Percentage of a budget spent before the recording interval is stretched, so that the rest lasts until the end of the day or month. Default 80",
+		Value: 80,
+	}
+	// CostGasFlag Gas used by each recordHeader Tx, for the cost projection
+	CostGasFlag = cli.Uint64Flag{
+		Name:  "cost.gas",
+		Usage: "Gas used by each recordHeader Tx, for the cost projection. Default 200000",
+		Value: recordHeaderGasEstimate,
+	}
+
+	// Treasury flags
+
+	// TreasuryAccountFlag Keystore account Oracle accounts are topped up from
+	TreasuryAccountFlag = cli.StringFlag{
+		Name:  "treasury.account",
+		Usage: "Address of a keystore account in the data directory which Oracle accounts are automatically topped up from. Disabled if not set",
+	}
+	// TreasuryPasswordFlag Path to the file containing the treasury account's password
+	TreasuryPasswordFlag = cli.StringFlag{
+		Name:  "treasury.password",
+		Usage: "Path to the file containing the treasury account's password. Otherwise " + TreasuryPasswordEnvVar + ", or an interactive prompt, is used",
+	}
+	// TreasuryThresholdFlag Balance, in UND, below which an Oracle account is topped up
+	TreasuryThresholdFlag = cli.StringFlag{
+		Name:  "treasury.threshold",
+		Usage: "Balance, in UND, below which an Oracle account is topped up from the treasury, e.g. 20. Default the low balance threshold",
+	}
+	// TreasuryAmountFlag Amount of UND transferred by each top-up
+	TreasuryAmountFlag = cli.StringFlag{
+		Name:  "treasury.amount",
+		Usage: "Amount of UND transferred from the treasury by each top-up, e.g. 50. Required with --treasury.account",
+	}
+	// TreasuryDailyMaxFlag Maximum UND the treasury may spend on top-ups per UTC day
+	TreasuryDailyMaxFlag = cli.StringFlag{
+		Name:  "treasury.dailymax",
+		Usage: "Maximum UND the treasury may spend on top-ups, including Tx fees, per UTC day. 0 for no limit. Default 100",
+		Value: "100",
+	}
+	// TreasuryAuditFlag Path of the top-up audit log
+	TreasuryAuditFlag = cli.StringFlag{
+		Name:  "treasury.audit",
+		Usage: "Path of the audit log every top-up is appended to, as JSON. Default [datadir]/treasury/audit.log",
+	}
+
+	// Webhook flags
+
+	// WebhookURLFlag Comma separated URLs to POST event notifications to
+	WebhookURLFlag = cli.StringFlag{
+		Name:  "webhook.url",
+		Usage: "Comma separated URLs to POST event notifications to as JSON, e.g. https://hooks.example.com/oracle",
+	}
+	// WebhookEventsFlag Comma separated events to send to the webhooks
+	WebhookEventsFlag = cli.StringFlag{
+		Name:  "webhook.events",
+		Usage: "Comma separated events to send to the webhooks, e.g. recording_failed,low_balance. Default all events",
+	}
+	// WebhookSecretFlag File containing the secret webhook payloads are signed with
+	WebhookSecretFlag = cli.StringFlag{
+		Name:  "webhook.secret",
+		Usage: "File containing the secret webhook payloads are signed with, using HMAC-SHA256",
+	}
+	// WebhookRetriesFlag Number of times a failed webhook is retried
+	WebhookRetriesFlag = cli.IntFlag{
+		Name:  "webhook.retries",
+		Usage: "Number of times a failed webhook is retried, with exponential backoff. Default 3",
+		Value: 3,
 	}
 
 	// WRKChain flags
@@ -136,6 +391,70 @@ var (
 		Name:  "hash.state",
 		Usage: "If set, WRKChain Oracle will submit the WRKChain's State Root hash",
 	}
+
+	// Hook flags
+
+	// HookPreFlag Command run before each recordHeader Tx is submitted
+	HookPreFlag = cli.StringFlag{
+		Name:  "hook.pre",
+		Usage: "Command run with sh before each recordHeader Tx is submitted, with the WRKChain header as JSON on stdin. A non-zero exit vetoes the recording",
+	}
+	// HookPostFlag Command run after each recordHeader Tx is submitted
+	HookPostFlag = cli.StringFlag{
+		Name:  "hook.post",
+		Usage: "Command run with sh after each recordHeader Tx is submitted, with the WRKChain header and Tx, or error, as JSON on stdin",
+	}
+	// HookTimeoutFlag Maximum time a hook may run for, in seconds
+	HookTimeoutFlag = cli.Int64Flag{
+		Name:  "hook.timeout",
+		Usage: "Maximum time a hook may run for, in seconds, before it and any processes it started are killed. A pre-submit hook which times out vetoes the recording. Default 30",
+		Value: 30,
+	}
+
+	// Metrics flags
+
+	// MetricsAddrFlag Address to serve Prometheus metrics on
+	MetricsAddrFlag = cli.StringFlag{
+		Name:  "metrics.addr",
+		Usage: "Address to serve Prometheus metrics, and health and readiness checks, on while recording, e.g. 127.0.0.1:9090. Metrics are served at /metrics, and the checks at /healthz and /readyz. Disabled if not set",
+	}
+	// HealthSLAFlag Maximum time between successful recordings for the Oracle to be healthy
+	HealthSLAFlag = cli.Int64Flag{
+		Name:  "health.sla",
+		Usage: "Maximum time, in seconds, between successful recordings for /healthz to report the Oracle as healthy. Default 3 x --freq",
+	}
+
+	// Logging flags
+
+	// LogLevelFlag Most verbose level of log events output
+	LogLevelFlag = cli.StringFlag{
+		Name:  "log.level",
+		Usage: "Most verbose level of log events output: crit, error, warn, info, debug or trace. Default info",
+		Value: "info",
+	}
+	// LogFormatFlag Format of log events
+	LogFormatFlag = cli.StringFlag{
+		Name:  "log.format",
+		Usage: "Format of log events: terminal, or json for one JSON object per event. Default terminal",
+		Value: LogFormatTerminal,
+	}
+	// LogFileFlag File to also write log events to
+	LogFileFlag = cli.StringFlag{
+		Name:  "log.file",
+		Usage: "Path of a file to also write log events to, in --log.format. The file is rotated once it reaches --log.maxsize",
+	}
+	// LogMaxSizeFlag Size at which the log file is rotated, in MB
+	LogMaxSizeFlag = cli.Int64Flag{
+		Name:  "log.maxsize",
+		Usage: "Size, in MB, at which --log.file is rotated. Default 100",
+		Value: 100,
+	}
+	// LogMaxBackupsFlag Number of rotated log files kept
+	LogMaxBackupsFlag = cli.IntFlag{
+		Name:  "log.maxbackups",
+		Usage: "Number of rotated log files kept, named [log.file].1, [log.file].2 and so on. Default 5",
+		Value: 5,
+	}
 )
 
 // DirectoryString Custom type which is registered in the flags library which cli uses for
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	ethereum "github.com/unification-com/mainchain"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+/*
+GasPriceStrategySuggested: use the gas price suggested by the Mainchain node
+GasPriceStrategyFixed: use the fixed gas price set with --gas.price
+GasPriceStrategyPercentile: use a percentile of the gas prices paid in recent Mainchain blocks
+*/
+const (
+	GasPriceStrategySuggested  = "suggested"
+	GasPriceStrategyFixed      = "fixed"
+	GasPriceStrategyPercentile = "percentile"
+)
+
+// gasStrategy estimates gas limits and selects gas prices for Txs sent to Mainchain
+type gasStrategy struct {
+	client     *MainchainClient
+	margin     uint64
+	strategy   string
+	fixed      *big.Int
+	percentile uint64
+	blocks     uint64
+	max        *big.Int
+
+	mu     sync.Mutex
+	recent map[common.Hash]*blockGasPrices
+}
+
+// blockGasPrices the gas prices paid by the Txs in a Mainchain block, cached by the percentile
+// strategy so that each block is only fetched once
+type blockGasPrices struct {
+	number uint64
+	parent common.Hash
+	prices []*big.Int
+}
+
+// newGasStrategy configure the gas strategy from the command line
+func newGasStrategy(ctx *cli.Context, client *MainchainClient) *gasStrategy {
+	g := &gasStrategy{
+		client:     client,
+		margin:     ctx.Uint64(GasMarginFlag.Name),
+		strategy:   ctx.String(GasPriceStrategyFlag.Name),
+		fixed:      new(big.Int).SetUint64(ctx.Uint64(GasPriceFlag.Name)),
+		percentile: ctx.Uint64(GasPricePercentileFlag.Name),
+		blocks:     ctx.Uint64(GasPriceBlocksFlag.Name),
+		max:        new(big.Int).SetUint64(ctx.Uint64(GasPriceMaxFlag.Name)),
+		recent:     make(map[common.Hash]*blockGasPrices),
+	}
+
+	switch g.strategy {
+	case GasPriceStrategySuggested, GasPriceStrategyPercentile:
+	case GasPriceStrategyFixed:
+		if g.fixed.Sign() == 0 {
+			Fatalf("--%s required for the %s gas price strategy", GasPriceFlag.Name, GasPriceStrategyFixed)
+		}
+	default:
+		Fatalf("Unknown gas price strategy %s. Must be one of %s, %s or %s", g.strategy, GasPriceStrategySuggested, GasPriceStrategyFixed, GasPriceStrategyPercentile)
+	}
+
+	if g.percentile > 100 {
+		Fatalf("--%s must be between 0 and 100", GasPricePercentileFlag.Name)
+	}
+
+	return g
+}
+
+// GasPrice select a gas price according to the configured strategy, capped at the maximum gas price
+func (g *gasStrategy) GasPrice(bgCtx context.Context) (*big.Int, error) {
+	var gasPrice *big.Int
+	var err error
+
+	switch g.strategy {
+	case GasPriceStrategyFixed:
+		gasPrice = new(big.Int).Set(g.fixed)
+	case GasPriceStrategyPercentile:
+		gasPrice, err = g.percentileGasPrice(bgCtx)
+	default:
+		gasPrice, err = g.client.SuggestGasPrice(bgCtx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if g.max.Sign() > 0 && gasPrice.Cmp(g.max) > 0 {
+		log.Warn("Gas price exceeds maximum - using the maximum", "gasprice", gasPrice, "max", g.max)
+		gasPrice = new(big.Int).Set(g.max)
+	}
+
+	return gasPrice, nil
+}
+
+// percentileGasPrice the configured percentile of gas prices paid by Txs in recent blocks.
+// Falls back to the node's suggested gas price if there are no recent Txs.
+func (g *gasStrategy) percentileGasPrice(bgCtx context.Context) (*big.Int, error) {
+	head, err := g.client.HeaderByNumber(bgCtx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// walk back from the head by parent hash, so that only blocks not seen before are fetched, and
+	// blocks dropped by a reorg are never used
+	var prices []*big.Int
+	recent := make(map[common.Hash]*blockGasPrices)
+	hash := head.Hash()
+	for i := uint64(0); i < g.blocks; i++ {
+		block, ok := g.recent[hash]
+		if !ok {
+			if block, err = g.fetchGasPrices(bgCtx, hash); err != nil {
+				return nil, err
+			}
+		}
+		recent[hash] = block
+		prices = append(prices, block.prices...)
+		if block.number == 0 {
+			break
+		}
+		hash = block.parent
+	}
+	// only keep the blocks in the current window
+	g.recent = recent
+
+	if len(prices) == 0 {
+		return g.client.SuggestGasPrice(bgCtx)
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Cmp(prices[j]) < 0
+	})
+
+	return new(big.Int).Set(prices[(uint64(len(prices))-1)*g.percentile/100]), nil
+}
+
+// fetchGasPrices fetch the block from Mainchain, and the gas prices paid by its Txs
+func (g *gasStrategy) fetchGasPrices(bgCtx context.Context, hash common.Hash) (*blockGasPrices, error) {
+	block, err := g.client.BlockByHash(bgCtx, hash)
+	if err != nil {
+		return nil, err
+	}
+	b := &blockGasPrices{
+		number: block.NumberU64(),
+		parent: block.ParentHash(),
+	}
+	for _, tx := range block.Transactions() {
+		b.prices = append(b.prices, tx.GasPrice())
+	}
+	return b, nil
+}
+
+// GasLimit estimate the gas required by the Tx, adding the configured safety margin
+func (g *gasStrategy) GasLimit(bgCtx context.Context, msg ethereum.CallMsg) (uint64, uint64, error) {
+	estimate, err := g.client.EstimateGas(bgCtx, msg)
+	if err != nil {
+		return 0, 0, err
+	}
+	return estimate, estimate + estimate*g.margin/100, nil
+}
+
+// Max the maximum gas price, or nil if there is no maximum
+func (g *gasStrategy) Max() *big.Int {
+	if g.max.Sign() == 0 {
+		return nil
+	}
+	return g.max
+}
+
+// Estimate estimate the gas limit for the Tx and select its gas price, outputting the expected fee
+func (g *gasStrategy) Estimate(bgCtx context.Context, method string, msg ethereum.CallMsg) (uint64, *big.Int, error) {
+	estimate, gasLimit, err := g.GasLimit(bgCtx, msg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not estimate gas for %s: %v", method, err)
+	}
+
+	gasPrice, err := g.GasPrice(bgCtx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not get gas price: %v", err)
+	}
+
+	logTxFee(method, estimate, gasLimit, gasPrice)
+
+	return gasLimit, gasPrice, nil
+}
+
+// logTxFee output the expected fee for a Tx, and the maximum fee should it use its full gas limit
+func logTxFee(method string, estimate uint64, gasLimit uint64, gasPrice *big.Int) {
+	expectedFee := new(big.Int).Mul(new(big.Int).SetUint64(estimate), gasPrice)
+	maxFee := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), gasPrice)
+	log.Info("Tx fee", "method", method, "gasestimate", estimate, "gaslimit", gasLimit, "gasprice", gasPrice, "fee", weiToUnd(expectedFee), "maxfee", weiToUnd(maxFee))
+}
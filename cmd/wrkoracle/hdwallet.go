@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/unification-com/mainchain/accounts"
+	"github.com/unification-com/mainchain/common/math"
+	"github.com/unification-com/mainchain/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+	"math/big"
+	"strings"
+)
+
+/*
+DefaultHDPath: BIP-44 derivation path of Ethereum accounts, to which the account index is appended
+hdHardened: offset of hardened BIP-32 child indexes
+hdPreviewCount: number of derived addresses output so that the right account can be confirmed
+*/
+const (
+	DefaultHDPath         = "m/44'/60'/0'/0"
+	hdHardened     uint32 = 0x80000000
+	hdPreviewCount        = 5
+)
+
+// errInvalidHDKey returned in the astronomically unlikely case a derived key is invalid
+var errInvalidHDKey = errors.New("invalid derived key - use the next index")
+
+// hdKey a BIP-32 extended private key
+type hdKey struct {
+	key       *big.Int
+	chainCode []byte
+}
+
+// bip39Index the index of each word in the BIP-39 English wordlist
+var bip39Index = func() map[string]int {
+	index := make(map[string]int, len(bip39English))
+	for i, word := range bip39English {
+		index[word] = i
+	}
+	return index
+}()
+
+// mnemonicSeed the BIP-39 seed for the mnemonic and passphrase, both NFKD normalised. Returns an
+// error if the mnemonic does not have a valid number of words, has a word not in the BIP-39 English
+// wordlist, or its checksum is invalid. Words are identified by position only, so that the
+// mnemonic is not output
+func mnemonicSeed(mnemonic string, passphrase string) ([]byte, error) {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, fmt.Errorf("mnemonic has %d words. Must be 12, 15, 18, 21 or 24", len(words))
+	}
+
+	// each word encodes 11 bits: the entropy, followed by the first len(words)/3 bits of its SHA-256
+	bits := new(big.Int)
+	for i, word := range words {
+		index, ok := bip39Index[word]
+		if !ok {
+			return nil, fmt.Errorf("mnemonic word %d is not in the BIP-39 English wordlist", i+1)
+		}
+		bits.Lsh(bits, 11).Or(bits, big.NewInt(int64(index)))
+	}
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1))
+	entropy := math.PaddedBigBytes(bits.Rsh(bits, checksumBits), len(words)*4/3)
+	hash := sha256.Sum256(entropy)
+	if uint64(hash[0]>>(8-checksumBits)) != checksum.Uint64() {
+		return nil, errors.New("mnemonic checksum is invalid. Check the words and their order")
+	}
+
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+	return pbkdf2.Key([]byte(strings.Join(words, " ")), []byte(salt), 2048, 64, sha512.New), nil
+}
+
+// hdMasterKey the BIP-32 master key for the seed
+func hdMasterKey(seed []byte) (*hdKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Sign() == 0 || key.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, errInvalidHDKey
+	}
+	return &hdKey{key: key, chainCode: sum[32:]}, nil
+}
+
+// privateKey the extended key's ECDSA private key
+func (k *hdKey) privateKey() (*ecdsa.PrivateKey, error) {
+	return crypto.ToECDSA(math.PaddedBigBytes(k.key, 32))
+}
+
+// child derive the child key at index. Indexes from hdHardened are hardened
+func (k *hdKey) child(index uint32) (*hdKey, error) {
+	var data []byte
+	if index >= hdHardened {
+		data = append([]byte{0}, math.PaddedBigBytes(k.key, 32)...)
+	} else {
+		priv, err := k.privateKey()
+		if err != nil {
+			return nil, err
+		}
+		data = crypto.CompressPubkey(&priv.PublicKey)
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, errInvalidHDKey
+	}
+	key := tweak.Add(tweak, k.key)
+	key.Mod(key, n)
+	if key.Sign() == 0 {
+		return nil, errInvalidHDKey
+	}
+	return &hdKey{key: key, chainCode: sum[32:]}, nil
+}
+
+// derive derive the key at the derivation path
+func (k *hdKey) derive(path accounts.DerivationPath) (*hdKey, error) {
+	key := k
+	for _, index := range path {
+		var err error
+		if key, err = key.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// deriveMnemonicKey derive the private key at index on the BIP-44 base path from the mnemonic,
+// outputting the first few addresses on the base path so that the right account can be confirmed
+func deriveMnemonicKey(mnemonic string, basePath string, index uint32) (*ecdsa.PrivateKey, error) {
+	if index >= hdHardened {
+		return nil, fmt.Errorf("account index %d too large", index)
+	}
+	path, err := accounts.ParseDerivationPath(basePath)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := mnemonicSeed(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	master, err := hdMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	base, err := master.derive(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Addresses derived from", path)
+	preview := []uint32{}
+	for i := uint32(0); i < hdPreviewCount; i++ {
+		preview = append(preview, i)
+	}
+	if index >= hdPreviewCount {
+		preview = append(preview, index)
+	}
+	for _, i := range preview {
+		child, err := base.child(i)
+		if err != nil {
+			fmt.Printf("  %d: %v\n", i, err)
+			continue
+		}
+		priv, err := child.privateKey()
+		if err != nil {
+			return nil, err
+		}
+		selected := ""
+		if i == index {
+			selected = " <- selected"
+		}
+		fmt.Printf("  %d: %s%s\n", i, crypto.PubkeyToAddress(priv.PublicKey).Hex(), selected)
+	}
+
+	child, err := base.child(index)
+	if err != nil {
+		return nil, err
+	}
+	return child.privateKey()
+}
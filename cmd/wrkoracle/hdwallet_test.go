@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/unification-com/mainchain/accounts"
+	"github.com/unification-com/mainchain/common/math"
+	"github.com/unification-com/mainchain/crypto"
+	"strings"
+	"testing"
+)
+
+// BIP-39 test vectors, with the passphrase TREZOR, from
+// https://github.com/trezor/python-mnemonic/blob/master/vectors.json
+var bip39Vectors = []struct {
+	mnemonic string
+	seed     string
+}{
+	{
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		mnemonic: "legal winner thank year wave sausage worth useful legal winner thank yellow",
+		seed:     "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		seed:     "ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+	},
+	{
+		mnemonic: "letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter always",
+		seed:     "107d7c02a5aa6f38c58083ff74f04c607c2d2c0ecc55501dadd72d025b751bc27fe913ffb796f841c49b1d33b610cf0e91d3aa239027f5e99fe4ce9e5088cd65",
+	},
+	{
+		mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+		seed:     "bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+	},
+}
+
+func TestMnemonicSeedVectors(t *testing.T) {
+	for _, vector := range bip39Vectors {
+		seed, err := mnemonicSeed(vector.mnemonic, "TREZOR")
+		if err != nil {
+			t.Errorf("%q: %v", vector.mnemonic, err)
+			continue
+		}
+		if got := hex.EncodeToString(seed); got != vector.seed {
+			t.Errorf("%q: seed %s, want %s", vector.mnemonic, got, vector.seed)
+		}
+	}
+}
+
+func TestMnemonicSeedNormalisation(t *testing.T) {
+	mnemonic := bip39Vectors[0].mnemonic
+	want, err := mnemonicSeed(mnemonic, "caf\u00e9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fullwidth letters and ideographic spaces are NFKD normalised to ASCII
+	fullwidth := strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return '\u3000'
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + '\uff41'
+		}
+		return r
+	}, mnemonic)
+	// the composed and decomposed forms of the passphrase are the same once normalised
+	for _, input := range []struct{ mnemonic, passphrase string }{
+		{fullwidth, "caf\u00e9"},
+		{mnemonic, "cafe\u0301"},
+		{"  " + strings.Replace(mnemonic, " ", "\n", -1) + "\n", "caf\u00e9"},
+	} {
+		seed, err := mnemonicSeed(input.mnemonic, input.passphrase)
+		if err != nil {
+			t.Errorf("%q: %v", input.mnemonic, err)
+			continue
+		}
+		if !bytes.Equal(seed, want) {
+			t.Errorf("%q with passphrase %q: seed %x, want %x", input.mnemonic, input.passphrase, seed, want)
+		}
+	}
+}
+
+func TestMnemonicSeedInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		mnemonic string
+		want     string
+	}{
+		{
+			name:     "word count",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			want:     "has 11 words",
+		},
+		{
+			name:     "unknown word",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandonn abandon abandon abandon about",
+			want:     "word 8 is not in the BIP-39 English wordlist",
+		},
+		{
+			name:     "uppercase word",
+			mnemonic: "Abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			want:     "word 1 is not in the BIP-39 English wordlist",
+		},
+		{
+			name:     "checksum",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+			want:     "checksum is invalid",
+		},
+		{
+			name:     "word order",
+			mnemonic: "legal winner thank year wave sausage worth useful legal winner yellow thank",
+			want:     "checksum is invalid",
+		},
+		{
+			name:     "24 word checksum",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			want:     "checksum is invalid",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := mnemonicSeed(test.mnemonic, "")
+			if err == nil {
+				t.Fatal("invalid mnemonic accepted")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error %q does not mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+// BIP-32 test vector 1, from https://github.com/bitcoin/bips/blob/master/bip-0032.mediawiki
+func TestHDKeyVector(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path      accounts.DerivationPath
+		key       string
+		chainCode string
+	}{
+		{
+			path:      accounts.DerivationPath{},
+			key:       "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35",
+			chainCode: "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508",
+		},
+		{
+			path:      accounts.DerivationPath{hdHardened + 0},
+			key:       "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea",
+			chainCode: "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141",
+		},
+		{
+			path:      accounts.DerivationPath{hdHardened + 0, 1},
+			key:       "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368",
+			chainCode: "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19",
+		},
+		{
+			path:      accounts.DerivationPath{hdHardened + 0, 1, hdHardened + 2},
+			key:       "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca",
+			chainCode: "04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f",
+		},
+		{
+			path:      accounts.DerivationPath{hdHardened + 0, 1, hdHardened + 2, 2},
+			key:       "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4",
+			chainCode: "cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd",
+		},
+		{
+			path:      accounts.DerivationPath{hdHardened + 0, 1, hdHardened + 2, 2, 1000000000},
+			key:       "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8",
+			chainCode: "c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e",
+		},
+	}
+
+	master, err := hdMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		key, err := master.derive(test.path)
+		if err != nil {
+			t.Errorf("%v: %v", test.path, err)
+			continue
+		}
+		if got := hex.EncodeToString(math.PaddedBigBytes(key.key, 32)); got != test.key {
+			t.Errorf("%v: key %s, want %s", test.path, got, test.key)
+		}
+		if got := hex.EncodeToString(key.chainCode); got != test.chainCode {
+			t.Errorf("%v: chain code %s, want %s", test.path, got, test.chainCode)
+		}
+	}
+}
+
+func TestDeriveMnemonicKey(t *testing.T) {
+	key, err := deriveMnemonicKey(bip39Vectors[0].mnemonic, DefaultHDPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first Ethereum account of the mnemonic, as derived by other BIP-44 wallets
+	want := "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"
+	if got := crypto.PubkeyToAddress(key.PublicKey).Hex(); got != want {
+		t.Errorf("address %s, want %s", got, want)
+	}
+
+	if _, err := deriveMnemonicKey(bip39Vectors[0].mnemonic, DefaultHDPath, hdHardened); err == nil {
+		t.Error("hardened account index accepted")
+	}
+}
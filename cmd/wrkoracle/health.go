@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/ethclient"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout maximum time the RPC requests made by a single readiness check may take
+const healthCheckTimeout = 5 * time.Second
+
+// healthCheck the result of one of the checks behind /healthz or /readyz
+type healthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// healthReport the JSON body returned by /healthz and /readyz
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks"`
+}
+
+// oracleHealth tracks the recorder's progress through startup, and serves the health and readiness
+// checks. The recorder is ready once its accounts are unlocked, both chains are reachable, the
+// WRKChain is registered and the accounts are authorised, and an account's last checked balance is
+// above the low balance threshold. It is healthy while a recording has succeeded within the SLA
+type oracleHealth struct {
+	mu        sync.RWMutex
+	started   time.Time
+	sla       time.Duration
+	accounts  []common.Address
+	mainchain *MainchainClient
+	wrkchain  *ethclient.Client
+	chainID   *big.Int
+	balances  *balanceMonitor
+}
+
+// newOracleHealth create the health checks, with the maximum time allowed between recordings
+func newOracleHealth(sla time.Duration) *oracleHealth {
+	return &oracleHealth{
+		started: time.Now(),
+		sla:     sla,
+	}
+}
+
+// Unlocked the keys for the accounts have been unlocked
+func (h *oracleHealth) Unlocked(accounts []common.Address) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.accounts = accounts
+}
+
+// Connected the Mainchain and WRKChain clients have connected
+func (h *oracleHealth) Connected(mainchain *MainchainClient, wrkchain *ethclient.Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mainchain = mainchain
+	h.wrkchain = wrkchain
+}
+
+// Registered the WRKChain has been verified as registered, and the accounts as authorised
+func (h *oracleHealth) Registered(chainID *big.Int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.chainID = chainID
+}
+
+// Monitoring the accounts' balances are checked by the balance monitor before each recording
+func (h *oracleHealth) Monitoring(balances *balanceMonitor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.balances = balances
+}
+
+// readiness run the readiness checks
+func (h *oracleHealth) readiness(bgCtx context.Context) []healthCheck {
+	h.mu.RLock()
+	accounts, mainchain, wrkchain, chainID, balances := h.accounts, h.mainchain, h.wrkchain, h.chainID, h.balances
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(bgCtx, healthCheckTimeout)
+	defer cancel()
+
+	checks := make([]healthCheck, 0, 5)
+
+	key := healthCheck{Name: "key"}
+	if len(accounts) == 0 {
+		key.Detail = "accounts not unlocked yet"
+	} else {
+		key.OK = true
+		key.Detail = fmt.Sprintf("%d account(s) unlocked", len(accounts))
+	}
+	checks = append(checks, key)
+
+	mc := healthCheck{Name: "mainchain"}
+	if mainchain == nil {
+		mc.Detail = "not connected yet"
+	} else if err := mainchain.Reachable(); err != nil {
+		mc.Detail = err.Error()
+	} else {
+		mc.OK = true
+	}
+	checks = append(checks, mc)
+
+	wc := healthCheck{Name: "wrkchain"}
+	if wrkchain == nil {
+		wc.Detail = "not connected yet"
+	} else if header, err := wrkchain.HeaderByNumber(ctx, nil); err != nil {
+		wc.Detail = err.Error()
+	} else {
+		wc.OK = true
+		wc.Detail = fmt.Sprintf("head %v", header.Number)
+	}
+	checks = append(checks, wc)
+
+	reg := healthCheck{Name: "registration"}
+	if chainID == nil {
+		reg.Detail = "WRKChain registration and account authorisation not verified yet"
+	} else {
+		reg.OK = true
+		reg.Detail = fmt.Sprintf("WRKChain %v registered, and accounts authorised at registration", chainID)
+	}
+	checks = append(checks, reg)
+
+	// the balances last fetched by the account pool are used, rather than fetching them for each probe
+	bal := healthCheck{Name: "balance"}
+	if balances == nil || len(accounts) == 0 {
+		bal.Detail = "balances not checked yet"
+	} else {
+		// the low balance threshold, but at least enough to pay the tax
+		threshold := balances.Threshold()
+		if threshold.Cmp(calcTax()) < 0 {
+			threshold = calcTax()
+		}
+		bal.Detail = "balances not checked yet"
+		for _, account := range accounts {
+			balance, ok := balances.Balance(account)
+			if !ok {
+				continue
+			}
+			if balance.Cmp(threshold) >= 0 {
+				bal.OK = true
+				bal.Detail = fmt.Sprintf("%s has %v UND", account.Hex(), weiToUnd(balance))
+				break
+			}
+			bal.Detail = fmt.Sprintf("no account has at least %v UND", weiToUnd(threshold))
+		}
+	}
+	checks = append(checks, bal)
+
+	return checks
+}
+
+// liveness run the health checks
+func (h *oracleHealth) liveness() []healthCheck {
+	check := healthCheck{Name: "recording"}
+	last, ok := metrics.LastRecorded()
+	switch {
+	case ok && time.Since(last) <= h.sla:
+		check.OK = true
+		check.Detail = fmt.Sprintf("last recorded %v ago", time.Since(last).Round(time.Second))
+	case ok:
+		check.Detail = fmt.Sprintf("last recorded %v ago, longer than the SLA of %v", time.Since(last).Round(time.Second), h.sla)
+	case time.Since(h.started) <= h.sla:
+		check.OK = true
+		check.Detail = fmt.Sprintf("nothing recorded yet. Started %v ago, within the SLA of %v", time.Since(h.started).Round(time.Second), h.sla)
+	default:
+		check.Detail = fmt.Sprintf("nothing recorded since starting %v ago, longer than the SLA of %v", time.Since(h.started).Round(time.Second), h.sla)
+	}
+	return []healthCheck{check}
+}
+
+// writeHealthReport write the checks as JSON, with status 200 if all passed, otherwise 503
+func writeHealthReport(w http.ResponseWriter, checks []healthCheck) {
+	report := healthReport{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			report.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ServeHealthz serve the health checks
+func (h *oracleHealth) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, h.liveness())
+}
+
+// ServeReadyz serve the readiness checks
+func (h *oracleHealth) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, h.readiness(r.Context()))
+}
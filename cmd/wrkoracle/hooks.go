@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"math/big"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/*
+HookPre: the hook run before each recordHeader Tx is submitted. A non-zero exit vetoes the recording
+HookPost: the hook run after each recordHeader Tx is submitted, or fails to be
+*/
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+)
+
+// hookOutputLimit maximum amount of a hook's output included in log events
+const hookOutputLimit = 1024
+
+// hookHeader the WRKChain header being recorded, as passed to the hooks
+type hookHeader struct {
+	ChainID   *big.Int `json:"chainid"`
+	Height    *big.Int `json:"height"`
+	Hash      string   `json:"hash"`
+	Parent    string   `json:"parent"`
+	Receipt   string   `json:"receipt"`
+	TxRoot    string   `json:"txroot"`
+	StateRoot string   `json:"stateroot"`
+	Sealer    string   `json:"sealer"`
+}
+
+// hookTx the recordHeader Tx, as passed to the hooks. The pre-submit hook is given the Tx before
+// it is signed, so without its hash
+type hookTx struct {
+	Hash     string   `json:"hash,omitempty"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Nonce    uint64   `json:"nonce"`
+	Gas      uint64   `json:"gas"`
+	GasPrice *big.Int `json:"gasprice"`
+	Data     string   `json:"data"`
+}
+
+// hookPayload the JSON written to a hook's stdin
+type hookPayload struct {
+	Hook   string      `json:"hook"`
+	Header *hookHeader `json:"header"`
+	Tx     *hookTx     `json:"tx,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// recordHooks commands run before and after each recordHeader Tx is submitted
+type recordHooks struct {
+	pre     string
+	post    string
+	timeout time.Duration
+}
+
+// newRecordHooks the hook commands from the --hook.* flags. Either command may be empty
+func newRecordHooks(ctx *cli.Context) *recordHooks {
+	hooks := &recordHooks{
+		pre:     strings.TrimSpace(ctx.String(HookPreFlag.Name)),
+		post:    strings.TrimSpace(ctx.String(HookPostFlag.Name)),
+		timeout: time.Duration(ctx.Int64(HookTimeoutFlag.Name)) * time.Second,
+	}
+	if hooks.pre != "" {
+		log.Info("Running pre-submit hook", "cmd", hooks.pre, "timeout", hooks.timeout)
+	}
+	if hooks.post != "" {
+		log.Info("Running post-submit hook", "cmd", hooks.post, "timeout", hooks.timeout)
+	}
+	return hooks
+}
+
+// newHookTx the Tx details passed to the hooks
+func newHookTx(tx *types.Transaction, from common.Address) *hookTx {
+	t := &hookTx{
+		Hash:     tx.Hash().Hex(),
+		From:     from.Hex(),
+		Nonce:    tx.Nonce(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Data:     common.ToHex(tx.Data()),
+	}
+	if tx.To() != nil {
+		t.To = tx.To().Hex()
+	}
+	return t
+}
+
+// run run the hook command with sh, writing the payload to its stdin. The command, along with any
+// processes it started, is killed if it runs for longer than the timeout. Returns an error if the command could not be run, exited
+// non-zero or timed out
+func (h *recordHooks) run(command string, payload *hookPayload) error {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	setProcessGroup(cmd)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), "WRKORACLE_HOOK="+payload.Hook)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Wait also waits for the output to be copied, which blocks for as long as any process the hook
+	// started holds stdout open, so the timeout doesn't wait for Wait to return
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(h.timeout):
+		if err := killProcessGroup(cmd); err != nil {
+			log.Warn("Could not kill timed out hook", "hook", payload.Hook, "pid", cmd.Process.Pid, "err", err)
+		}
+		log.Debug("Hook timed out", "hook", payload.Hook, "height", payload.Header.Height, "timeout", h.timeout)
+		return fmt.Errorf("timed out after %v", h.timeout)
+	}
+
+	out := strings.TrimSpace(output.String())
+	if len(out) > hookOutputLimit {
+		out = out[:hookOutputLimit] + "..."
+	}
+	log.Debug("Ran hook", "hook", payload.Hook, "height", payload.Header.Height, "elapsed", time.Since(start).Round(time.Millisecond), "output", out, "err", err)
+
+	if err != nil && out != "" {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return err
+}
+
+// Pre run the pre-submit hook, if configured, with the Tx which will be sent if it succeeds.
+// Returns an error if the hook vetoed the recording
+func (h *recordHooks) Pre(header *hookHeader, tx *hookTx) error {
+	if h.pre == "" {
+		return nil
+	}
+	// the Tx is not signed yet, so its hash is not final
+	tx.Hash = ""
+	return h.run(h.pre, &hookPayload{Hook: HookPre, Header: header, Tx: tx})
+}
+
+// Post run the post-submit hook, if configured, with the submitted Tx, or the error submitting it.
+// A failing post-submit hook is logged, but does not affect the recording
+func (h *recordHooks) Post(header *hookHeader, tx *hookTx, submitErr error) {
+	if h.post == "" {
+		return
+	}
+	payload := &hookPayload{Hook: HookPost, Header: header, Tx: tx}
+	if submitErr != nil {
+		payload.Error = submitErr.Error()
+	}
+	if err := h.run(h.post, payload); err != nil {
+		log.Warn("Post-submit hook failed", "height", header.Height, "err", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHookHeader() *hookHeader {
+	return &hookHeader{
+		ChainID: big.NewInt(50009),
+		Height:  big.NewInt(560),
+		Hash:    "0x69876f4b",
+		Sealer:  "0x160B51e66e51327ac31C643f7675B8A9006aEE1E",
+	}
+}
+
+func testHookDir(t *testing.T) (string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are run with sh")
+	}
+	dir, err := ioutil.TempDir("", "wrkoracle-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestPreHookPayload(t *testing.T) {
+	dir, cleanup := testHookDir(t)
+	defer cleanup()
+	out := filepath.Join(dir, "payload.json")
+
+	hooks := &recordHooks{pre: "cat > " + out + " && test \"$WRKORACLE_HOOK\" = pre", timeout: 10 * time.Second}
+	tx := &hookTx{
+		Hash:     "0xf02c0544",
+		From:     "0x160B51e66e51327ac31C643f7675B8A9006aEE1E",
+		To:       WRKChainRootContractAddress,
+		Nonce:    12,
+		Gas:      238008,
+		GasPrice: big.NewInt(1000000000),
+		Data:     "0x01",
+	}
+	if err := hooks.Pre(testHookHeader(), tx); err != nil {
+		t.Fatalf("pre-submit hook failed: %v", err)
+	}
+
+	blob, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload hookPayload
+	if err := json.Unmarshal(blob, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", blob, err)
+	}
+	if payload.Hook != HookPre || payload.Header == nil || payload.Header.Height.Cmp(big.NewInt(560)) != 0 {
+		t.Errorf("unexpected payload %s", blob)
+	}
+	// the unsigned Tx is passed without a hash
+	if payload.Tx == nil || payload.Tx.Nonce != 12 || payload.Tx.Gas != 238008 || payload.Tx.GasPrice.Cmp(big.NewInt(1000000000)) != 0 {
+		t.Errorf("payload %s does not have the Tx's nonce, gas and gas price", blob)
+	}
+	if strings.Contains(string(blob), `"hash":"0xf02c0544"`) {
+		t.Errorf("payload %s has the unsigned Tx's hash", blob)
+	}
+}
+
+func TestPreHookVeto(t *testing.T) {
+	_, cleanup := testHookDir(t)
+	defer cleanup()
+
+	hooks := &recordHooks{pre: "echo not now; exit 3", timeout: 10 * time.Second}
+	err := hooks.Pre(testHookHeader(), &hookTx{})
+	if err == nil {
+		t.Fatal("non-zero exit did not veto the recording")
+	}
+	if !strings.Contains(err.Error(), "not now") {
+		t.Errorf("error %q does not include the hook's output", err)
+	}
+
+	if err := (&recordHooks{timeout: time.Second}).Pre(testHookHeader(), &hookTx{}); err != nil {
+		t.Errorf("unset pre-submit hook failed: %v", err)
+	}
+}
+
+func TestHookTimeoutKillsProcessGroup(t *testing.T) {
+	dir, cleanup := testHookDir(t)
+	defer cleanup()
+	marker := filepath.Join(dir, "marker")
+
+	// the background process holds stdout open, and would outlive sh if only sh were killed
+	hooks := &recordHooks{pre: "(sleep 1; touch " + marker + ") & wait", timeout: 200 * time.Millisecond}
+	start := time.Now()
+	err := hooks.Pre(testHookHeader(), &hookTx{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out hook took %v to return", elapsed)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("process started by the timed out hook was not killed")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"github.com/unification-com/mainchain/log"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/urfave/cli.v1"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/*
+LogFormatTerminal: human readable log lines, coloured when output to a terminal
+LogFormatJSON: one JSON object per log event
+*/
+const (
+	LogFormatTerminal = "terminal"
+	LogFormatJSON     = "json"
+)
+
+// loggingConfigured set once setupLogging has configured logging from the --log.* flags, after
+// which fatal errors and warnings are logged, so that they reach --log.file and the chosen format
+var loggingConfigured bool
+
+// rotatingFile a log file which is rotated once it reaches maxSize bytes. Rotated files are
+// renamed path.1, path.2 and so on, oldest last, keeping at most maxBackups of them
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile open the log file for appending, creating it if necessary
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open open the log file, and find its current size. Caller must hold the lock
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// rotate close the log file, shift the backups along, dropping the oldest, and start a new log
+// file. Caller must hold the lock
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+		for i := r.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Write write to the log file, rotating it first if the write would take it past its maximum size
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// logFormat the log format for the --log.format flag. Terminal output is only coloured when
+// stdout is a terminal, and never in the log file
+func logFormat(format string, color bool) (log.Format, error) {
+	switch format {
+	case LogFormatTerminal:
+		return log.TerminalFormat(color), nil
+	case LogFormatJSON:
+		return log.JSONFormat(), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q. Must be %s or %s", format, LogFormatTerminal, LogFormatJSON)
+	}
+}
+
+// setDefaultLogging log at info level to stdout, in the terminal format. Used by commands which do
+// not configure logging, so that log events from shared code are still output
+func setDefaultLogging() {
+	handler := log.StreamHandler(os.Stdout, log.TerminalFormat(terminal.IsTerminal(int(os.Stdout.Fd()))))
+	log.Root().SetHandler(log.LvlFilterHandler(log.LvlInfo, handler))
+}
+
+// setupLogging configure the log level and format from the --log.* flags. Log events are written to
+// stdout, and also to --log.file if set
+func setupLogging(ctx *cli.Context) error {
+	lvl, err := log.LvlFromString(ctx.String(LogLevelFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	stdoutFormat, err := logFormat(ctx.String(LogFormatFlag.Name), terminal.IsTerminal(int(os.Stdout.Fd())))
+	if err != nil {
+		return err
+	}
+	handlers := []log.Handler{log.StreamHandler(os.Stdout, stdoutFormat)}
+
+	if ctx.IsSet(LogFileFlag.Name) {
+		file, err := openRotatingFile(
+			ctx.String(LogFileFlag.Name),
+			ctx.Int64(LogMaxSizeFlag.Name)*1024*1024,
+			ctx.Int(LogMaxBackupsFlag.Name),
+		)
+		if err != nil {
+			return fmt.Errorf("could not open log file: %v", err)
+		}
+		fileFormat, err := logFormat(ctx.String(LogFormatFlag.Name), false)
+		if err != nil {
+			return err
+		}
+		handlers = append(handlers, log.StreamHandler(file, fileFormat))
+	}
+
+	log.Root().SetHandler(log.LvlFilterHandler(lvl, log.MultiHandler(handlers...)))
+	loggingConfigured = true
+	return nil
+}
@@ -14,17 +14,78 @@ var (
 		DataDirectoryFlag,
 		UndTestnetFlag,
 		MainchainJSONRPCFlag,
+		MainchainHealthCheckFlag,
+		MainchainMaxHeadDriftFlag,
+		MainchainChainIDFlag,
 	}
 
 	regFlags = []cli.Flag{
 		GenesisPathFlag,
 		AuthorisedAccountsFlag,
+		UnsignedOutFlag,
 	}
 
 	accFlags = []cli.Flag{
 		PasswordPathFlag,
+		PasswordFDFlag,
+		StrictPermsFlag,
+		NewPasswordPathFlag,
 		PrivateKeyPathFlag,
+		MnemonicPathFlag,
+		HDPathFlag,
+		HDIndexFlag,
+		ShredKeyFlag,
+		BackupSharesFlag,
+		BackupThresholdFlag,
 		AccountUnlockFlag,
+		SignerFlag,
+	}
+
+	policyFlags = []cli.Flag{
+		PolicyMaxGasPriceFlag,
+		PolicyDailySpendFlag,
+	}
+
+	gasFlags = []cli.Flag{
+		GasMarginFlag,
+		GasPriceStrategyFlag,
+		GasPriceFlag,
+		GasPricePercentileFlag,
+		GasPriceBlocksFlag,
+		GasPriceMaxFlag,
+	}
+
+	txFlags = []cli.Flag{
+		TxStuckTimeoutFlag,
+		TxGasBumpFlag,
+	}
+
+	balanceFlags = []cli.Flag{
+		BalanceWarnRecordingsFlag,
+		BalanceWarnUndFlag,
+	}
+
+	budgetFlags = []cli.Flag{
+		BudgetDailyFlag,
+		BudgetMonthlyFlag,
+		BudgetStretchFlag,
+		CostGasFlag,
+	}
+
+	treasuryFlags = []cli.Flag{
+		TreasuryAccountFlag,
+		TreasuryPasswordFlag,
+		TreasuryThresholdFlag,
+		TreasuryAmountFlag,
+		TreasuryDailyMaxFlag,
+		TreasuryAuditFlag,
+	}
+
+	webhookFlags = []cli.Flag{
+		WebhookURLFlag,
+		WebhookEventsFlag,
+		WebhookSecretFlag,
+		WebhookRetriesFlag,
 	}
 
 	wrkchainFlags = []cli.Flag{
@@ -35,6 +96,25 @@ var (
 		RecordTxRootFlag,
 		RecordStateRootFlag,
 	}
+
+	hookFlags = []cli.Flag{
+		HookPreFlag,
+		HookPostFlag,
+		HookTimeoutFlag,
+	}
+
+	metricsFlags = []cli.Flag{
+		MetricsAddrFlag,
+		HealthSLAFlag,
+	}
+
+	logFlags = []cli.Flag{
+		LogLevelFlag,
+		LogFormatFlag,
+		LogFileFlag,
+		LogMaxSizeFlag,
+		LogMaxBackupsFlag,
+	}
 )
 
 func init() {
@@ -48,15 +128,37 @@ func init() {
 	app.Copyright = "Copyright (c) 2019 Unification Foundation"
 	app.Commands = []cli.Command{
 		initCommand,
+		accountCommand,
 		registerCommand,
 		recordCommand,
+		doctorCommand,
+		txCommand,
+		signCommand,
+		broadcastCommand,
+		webhookCommand,
+		costCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
 	app.Flags = append(app.Flags, commonFlags...)
 	app.Flags = append(app.Flags, regFlags...)
 	app.Flags = append(app.Flags, accFlags...)
+	app.Flags = append(app.Flags, policyFlags...)
+	app.Flags = append(app.Flags, gasFlags...)
+	app.Flags = append(app.Flags, txFlags...)
+	app.Flags = append(app.Flags, balanceFlags...)
+	app.Flags = append(app.Flags, budgetFlags...)
+	app.Flags = append(app.Flags, treasuryFlags...)
+	app.Flags = append(app.Flags, webhookFlags...)
 	app.Flags = append(app.Flags, wrkchainFlags...)
+	app.Flags = append(app.Flags, hookFlags...)
+	app.Flags = append(app.Flags, metricsFlags...)
+	app.Flags = append(app.Flags, logFlags...)
+
+	app.Before = func(ctx *cli.Context) error {
+		setDefaultLogging()
+		return nil
+	}
 
 	app.After = func(ctx *cli.Context) error {
 		return nil
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ethereum "github.com/unification-com/mainchain"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/common/hexutil"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/ethclient"
+	"github.com/unification-com/mainchain/log"
+	"github.com/unification-com/mainchain/rpc"
+	"gopkg.in/urfave/cli.v1"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rpcTimeout is the maximum time a single health check request may take
+const rpcTimeout = 10 * time.Second
+
+// errNoMainchainEndpoint returned when none of the configured endpoints could service a request
+var errNoMainchainEndpoint = errors.New("no Mainchain JSON RPC endpoint available")
+
+// mainchainEndpoint a single Mainchain JSON RPC node, along with the result of its last health check
+type mainchainEndpoint struct {
+	url       string
+	rpc       *rpc.Client
+	client    *ethclient.Client
+	healthy   bool
+	chainID   *big.Int
+	head      uint64
+	lastErr   error
+	lastCheck time.Time
+}
+
+// MainchainClient Mainchain JSON RPC client backed by one or more endpoints. Endpoints
+// are used in priority order - the order given to --mainchain.rpc - skipping any which
+// failed their last health check. If a request fails due to the endpoint being
+// unreachable, it is retried on the next endpoint. MainchainClient satisfies
+// bind.ContractBackend, so can be used to load the WRKChain Root contract.
+type MainchainClient struct {
+	mu        sync.RWMutex
+	endpoints []*mainchainEndpoint
+	signingID *big.Int
+	maxDrift  uint64
+}
+
+// DialMainchain connect to each of the given Mainchain JSON RPC URLs. URLs should be
+// in priority order, highest first.
+func DialMainchain(urls []string) (*MainchainClient, error) {
+	if len(urls) == 0 {
+		return nil, errNoMainchainEndpoint
+	}
+	m := &MainchainClient{}
+	for _, url := range urls {
+		rpcClient, err := rpc.Dial(url)
+		if err != nil {
+			return nil, fmt.Errorf("could not dial %s: %v", url, err)
+		}
+		m.endpoints = append(m.endpoints, &mainchainEndpoint{
+			url:     url,
+			rpc:     rpcClient,
+			client:  ethclient.NewClient(rpcClient),
+			healthy: true,
+		})
+	}
+	return m, nil
+}
+
+// mainchainRPCURLs parse the comma separated --mainchain.rpc flag into a list of URLs
+func mainchainRPCURLs(ctx *cli.Context) []string {
+	var urls []string
+	for _, url := range strings.Split(ctx.String(MainchainJSONRPCFlag.Name), ",") {
+		url = strings.TrimSpace(url)
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// expectedChainID the chain ID Mainchain must report, and the flag it was configured by. This is
+// --mainchain.chainid if set, otherwise the und test network's chain ID if --und-testnet is set.
+// Returns 0 if neither is set, in which case the reported chain ID is used
+func expectedChainID(ctx *cli.Context) (uint64, string) {
+	testnet := ctx.Bool(UndTestnetFlag.Name)
+	if !ctx.IsSet(MainchainChainIDFlag.Name) {
+		if testnet {
+			return MainchainTestnetChainID, "--" + UndTestnetFlag.Name
+		}
+		return 0, ""
+	}
+
+	configured := ctx.Uint64(MainchainChainIDFlag.Name)
+	if testnet && configured != MainchainTestnetChainID {
+		Fatalf("--%s %d is not the und test network's chain ID %d", MainchainChainIDFlag.Name, configured, MainchainTestnetChainID)
+	}
+	return configured, "--" + MainchainChainIDFlag.Name
+}
+
+// connectMainchain dial the Mainchain endpoints configured via the command line, and
+// confirm they agree with each other before they are used
+func connectMainchain(ctx *cli.Context) *MainchainClient {
+	urls := mainchainRPCURLs(ctx)
+	log.Info("Connecting to Mainchain JSON RPC", "urls", strings.Join(urls, ","))
+
+	mainchainClient, err := DialMainchain(urls)
+	if err != nil {
+		Fatalf("Couldn't connect to Mainchain: %v", err)
+	}
+
+	if err := mainchainClient.CheckConsistency(context.Background(), ctx.Uint64(MainchainMaxHeadDriftFlag.Name)); err != nil {
+		Fatalf("Mainchain JSON RPC endpoints failed consistency check: %v", err)
+	}
+
+	expected, source := expectedChainID(ctx)
+	chainID, err := mainchainClient.VerifyChainID(context.Background(), expected, source)
+	if err != nil {
+		Fatalf("Mainchain chain ID check failed: %v", err)
+	}
+	log.Info("Mainchain chain ID", "chainid", chainID)
+
+	return mainchainClient
+}
+
+// requestChainID query eth_chainId from a JSON RPC node
+func requestChainID(ctx context.Context, client *rpc.Client) (*big.Int, error) {
+	var result hexutil.Big
+	if err := client.CallContext(ctx, &result, "eth_chainId"); err != nil {
+		return nil, err
+	}
+	return result.ToInt(), nil
+}
+
+// check run a health check against the endpoint, returning its chain ID and head height
+func (e *mainchainEndpoint) check(ctx context.Context) (*big.Int, uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+
+	chainID, err := requestChainID(ctx, e.rpc)
+	if err != nil {
+		// older nodes may not support eth_chainId
+		chainID, err = e.client.NetworkID(ctx)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header, err := e.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return chainID, header.Number.Uint64(), nil
+}
+
+// checkEndpoints run a health check against every endpoint
+func (m *MainchainClient) checkEndpoints(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range m.endpoints {
+		wg.Add(1)
+		go func(e *mainchainEndpoint) {
+			defer wg.Done()
+			chainID, head, err := e.check(ctx)
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			e.lastCheck = time.Now()
+			e.lastErr = err
+			e.healthy = err == nil
+			if err == nil {
+				e.chainID = chainID
+				e.head = head
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+// CheckHealth run a health check against every endpoint. Once the endpoints have passed the
+// consistency check, an endpoint which reports a chain ID other than the verified chain ID, or
+// whose head is more than the maximum drift behind the highest head, is also unhealthy
+func (m *MainchainClient) CheckHealth(ctx context.Context) {
+	m.checkEndpoints(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var highest uint64
+	for _, e := range m.endpoints {
+		if !e.healthy {
+			continue
+		}
+		if m.signingID != nil && e.chainID.Cmp(m.signingID) != 0 {
+			e.healthy = false
+			e.lastErr = fmt.Errorf("reports chain ID %v, but the verified chain ID is %v", e.chainID, m.signingID)
+			continue
+		}
+		if e.head > highest {
+			highest = e.head
+		}
+	}
+
+	if m.signingID == nil {
+		return
+	}
+	for _, e := range m.endpoints {
+		if e.healthy && highest-e.head > m.maxDrift {
+			e.healthy = false
+			e.lastErr = fmt.Errorf("head %d is %d blocks behind, more than the allowed %d", e.head, highest-e.head, m.maxDrift)
+		}
+	}
+}
+
+// CheckConsistency check the health of every endpoint, then confirm the healthy ones
+// report the same chain ID and have head heights within maxDrift blocks of each other.
+// maxDrift is also applied by later health checks
+func (m *MainchainClient) CheckConsistency(ctx context.Context, maxDrift uint64) error {
+	m.checkEndpoints(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxDrift = maxDrift
+
+	var reference *mainchainEndpoint
+	var highest, lowest uint64
+	for _, e := range m.endpoints {
+		if !e.healthy {
+			log.Warn("Mainchain JSON RPC is unhealthy", "url", e.url, "err", e.lastErr)
+			continue
+		}
+		log.Info("Mainchain JSON RPC", "url", e.url, "chainid", e.chainID, "head", e.head)
+		if reference == nil {
+			reference = e
+			highest, lowest = e.head, e.head
+			continue
+		}
+		if e.chainID.Cmp(reference.chainID) != 0 {
+			return fmt.Errorf("%s reports chain ID %v, but %s reports chain ID %v", e.url, e.chainID, reference.url, reference.chainID)
+		}
+		if e.head > highest {
+			highest = e.head
+		}
+		if e.head < lowest {
+			lowest = e.head
+		}
+	}
+
+	if reference == nil {
+		return errNoMainchainEndpoint
+	}
+	if highest-lowest > maxDrift {
+		return fmt.Errorf("head heights differ by %d blocks, more than the allowed %d", highest-lowest, maxDrift)
+	}
+	return nil
+}
+
+// MonitorHealth periodically re-check every endpoint, so that failed endpoints are
+// skipped, and recovered endpoints are brought back into use in priority order. An endpoint
+// which has moved to another chain, or fallen too far behind, is not brought back into use
+func (m *MainchainClient) MonitorHealth(interval time.Duration) {
+	for {
+		<-time.After(interval)
+		m.CheckHealth(context.Background())
+
+		m.mu.RLock()
+		for _, e := range m.endpoints {
+			if !e.healthy {
+				log.Warn("Mainchain JSON RPC is unhealthy", "url", e.url, "err", e.lastErr)
+			}
+		}
+		m.mu.RUnlock()
+	}
+}
+
+// Reachable returns nil if any endpoint passed its last health check, otherwise the highest
+// priority endpoint's error
+func (m *MainchainClient) Reachable() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, e := range m.endpoints {
+		if e.healthy {
+			return nil
+		}
+	}
+	if len(m.endpoints) > 0 && m.endpoints[0].lastErr != nil {
+		return fmt.Errorf("%s: %v", m.endpoints[0].url, m.endpoints[0].lastErr)
+	}
+	return errNoMainchainEndpoint
+}
+
+// ChainID the chain ID reported by the highest priority healthy endpoint
+func (m *MainchainClient) ChainID(ctx context.Context) (*big.Int, error) {
+	var chainID *big.Int
+	err := m.do("ChainID", func(e *mainchainEndpoint) (err error) {
+		chainID, err = requestChainID(ctx, e.rpc)
+		return err
+	})
+	return chainID, err
+}
+
+// VerifyChainID confirm the chain ID reported by Mainchain matches the configured chain ID (see
+// expectedChainID), and use it to sign Txs. source is the flag the chain ID was configured by, for
+// error messages. If configured is 0, the reported chain ID is used as-is. If Mainchain does not
+// support eth_chainId, the configured chain ID is used.
+func (m *MainchainClient) VerifyChainID(ctx context.Context, configured uint64, source string) (*big.Int, error) {
+	chainID, err := m.ChainID(ctx)
+	if err != nil {
+		if configured == 0 {
+			return nil, fmt.Errorf("could not get chain ID from Mainchain: %v. Set --%s or --%s", err, MainchainChainIDFlag.Name, UndTestnetFlag.Name)
+		}
+		log.Warn("Could not get chain ID from Mainchain - using the configured chain ID", "chainid", configured, "flag", source, "err", err)
+		chainID = new(big.Int).SetUint64(configured)
+	}
+
+	switch {
+	case configured == 0:
+		log.Info("Using the chain ID reported by Mainchain", "chainid", chainID, "require", "--"+MainchainChainIDFlag.Name+" or --"+UndTestnetFlag.Name)
+	case chainID.Cmp(new(big.Int).SetUint64(configured)) != 0:
+		return nil, fmt.Errorf("Mainchain reports chain ID %v, but %s expects chain ID %d", chainID, source, configured)
+	}
+
+	m.mu.Lock()
+	m.signingID = chainID
+	m.mu.Unlock()
+
+	return chainID, nil
+}
+
+// SigningChainID the verified chain ID used to sign Txs, or nil if VerifyChainID has not been run
+func (m *MainchainClient) SigningChainID() *big.Int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.signingID
+}
+
+// ordered return healthy endpoints in priority order, followed by the unhealthy ones,
+// as a last resort
+func (m *MainchainClient) ordered() []*mainchainEndpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ordered := make([]*mainchainEndpoint, 0, len(m.endpoints))
+	for _, e := range m.endpoints {
+		if e.healthy {
+			ordered = append(ordered, e)
+		}
+	}
+	for _, e := range m.endpoints {
+		if !e.healthy {
+			ordered = append(ordered, e)
+		}
+	}
+	return ordered
+}
+
+// markUnhealthy flag an endpoint as unhealthy until its next successful health check
+func (m *MainchainClient) markUnhealthy(e *mainchainEndpoint, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e.healthy {
+		log.Warn("Mainchain JSON RPC failed, failing over", "url", e.url, "err", err)
+	}
+	e.healthy = false
+	e.lastErr = err
+}
+
+// isEndpointError whether an error was caused by the endpoint itself, rather than
+// being a valid response from the node, such as a JSON RPC error or not found
+func isEndpointError(err error) bool {
+	if err == nil || err == ethereum.NotFound || err == context.Canceled {
+		return false
+	}
+	if _, ok := err.(interface{ ErrorCode() int }); ok {
+		return false
+	}
+	return true
+}
+
+// do run fn against each endpoint in order, until one does not fail with an endpoint error. Each
+// attempt's latency is recorded in the RPC metrics for method
+func (m *MainchainClient) do(method string, fn func(e *mainchainEndpoint) error) error {
+	err := errNoMainchainEndpoint
+	for _, e := range m.ordered() {
+		start := time.Now()
+		err = fn(e)
+		if !isEndpointError(err) {
+			metrics.ObserveRPC(ChainMainchain, method, start, nil)
+			return err
+		}
+		metrics.ObserveRPC(ChainMainchain, method, start, err)
+		m.markUnhealthy(e, err)
+	}
+	return err
+}
+
+// CodeAt see ethclient.Client
+func (m *MainchainClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = m.do("CodeAt", func(e *mainchainEndpoint) error {
+		code, err = e.client.CodeAt(ctx, account, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+// CallContract see ethclient.Client
+func (m *MainchainClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) (result []byte, err error) {
+	err = m.do("CallContract", func(e *mainchainEndpoint) error {
+		result, err = e.client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+// PendingCodeAt see ethclient.Client
+func (m *MainchainClient) PendingCodeAt(ctx context.Context, account common.Address) (code []byte, err error) {
+	err = m.do("PendingCodeAt", func(e *mainchainEndpoint) error {
+		code, err = e.client.PendingCodeAt(ctx, account)
+		return err
+	})
+	return code, err
+}
+
+// PendingCallContract see ethclient.Client
+func (m *MainchainClient) PendingCallContract(ctx context.Context, msg ethereum.CallMsg) (result []byte, err error) {
+	err = m.do("PendingCallContract", func(e *mainchainEndpoint) error {
+		result, err = e.client.PendingCallContract(ctx, msg)
+		return err
+	})
+	return result, err
+}
+
+// PendingNonceAt see ethclient.Client
+func (m *MainchainClient) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = m.do("PendingNonceAt", func(e *mainchainEndpoint) error {
+		nonce, err = e.client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+// NonceAt see ethclient.Client
+func (m *MainchainClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (nonce uint64, err error) {
+	err = m.do("NonceAt", func(e *mainchainEndpoint) error {
+		nonce, err = e.client.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return nonce, err
+}
+
+// BalanceAt see ethclient.Client
+func (m *MainchainClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (balance *big.Int, err error) {
+	err = m.do("BalanceAt", func(e *mainchainEndpoint) error {
+		balance, err = e.client.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return balance, err
+}
+
+// StorageAt see ethclient.Client
+func (m *MainchainClient) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) (value []byte, err error) {
+	err = m.do("StorageAt", func(e *mainchainEndpoint) error {
+		value, err = e.client.StorageAt(ctx, account, key, blockNumber)
+		return err
+	})
+	return value, err
+}
+
+// HeaderByNumber see ethclient.Client
+func (m *MainchainClient) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = m.do("HeaderByNumber", func(e *mainchainEndpoint) error {
+		header, err = e.client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+// BlockByNumber see ethclient.Client
+func (m *MainchainClient) BlockByNumber(ctx context.Context, number *big.Int) (block *types.Block, err error) {
+	err = m.do("BlockByNumber", func(e *mainchainEndpoint) error {
+		block, err = e.client.BlockByNumber(ctx, number)
+		return err
+	})
+	return block, err
+}
+
+// BlockByHash see ethclient.Client
+func (m *MainchainClient) BlockByHash(ctx context.Context, hash common.Hash) (block *types.Block, err error) {
+	err = m.do("BlockByHash", func(e *mainchainEndpoint) error {
+		block, err = e.client.BlockByHash(ctx, hash)
+		return err
+	})
+	return block, err
+}
+
+// TransactionByHash see ethclient.Client
+func (m *MainchainClient) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error) {
+	err = m.do("TransactionByHash", func(e *mainchainEndpoint) error {
+		tx, isPending, err = e.client.TransactionByHash(ctx, hash)
+		return err
+	})
+	return tx, isPending, err
+}
+
+// TransactionReceipt see ethclient.Client
+func (m *MainchainClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (receipt *types.Receipt, err error) {
+	err = m.do("TransactionReceipt", func(e *mainchainEndpoint) error {
+		receipt, err = e.client.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+// SuggestGasPrice see ethclient.Client
+func (m *MainchainClient) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = m.do("SuggestGasPrice", func(e *mainchainEndpoint) error {
+		price, err = e.client.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+// EstimateGas see ethclient.Client
+func (m *MainchainClient) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (gas uint64, err error) {
+	err = m.do("EstimateGas", func(e *mainchainEndpoint) error {
+		gas, err = e.client.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
+}
+
+// SendTransaction see ethclient.Client. The Tx is sent to the highest priority endpoint
+// which accepts it.
+func (m *MainchainClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return m.do("SendTransaction", func(e *mainchainEndpoint) error {
+		return e.client.SendTransaction(ctx, tx)
+	})
+}
+
+// FilterLogs see ethclient.Client
+func (m *MainchainClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = m.do("FilterLogs", func(e *mainchainEndpoint) error {
+		logs, err = e.client.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+// SubscribeFilterLogs see ethclient.Client
+func (m *MainchainClient) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (sub ethereum.Subscription, err error) {
+	err = m.do("SubscribeFilterLogs", func(e *mainchainEndpoint) error {
+		sub, err = e.client.SubscribeFilterLogs(ctx, q, ch)
+		return err
+	})
+	return sub, err
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"github.com/unification-com/mainchain/log"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+metricsNamespace: prefix of each metric's name
+ChainMainchain, ChainWrkchain: chain label values for RPC metrics
+*/
+const (
+	metricsNamespace = "wrkoracle"
+	ChainMainchain   = "mainchain"
+	ChainWrkchain    = "wrkchain"
+)
+
+// rpcDurationBuckets upper bounds, in seconds, of the RPC latency histogram buckets
+var rpcDurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric a Prometheus counter, gauge or histogram, with a series per combination of label values
+type metric struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	values  map[string]float64
+	hists   map[string]*histogram
+}
+
+// histogram cumulative bucket counts, sum and count of a histogram series
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// metricsRegistry the metrics exposed on --metrics.addr, in the order they were registered
+type metricsRegistry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// oracleMetrics the Oracle's metrics
+type oracleMetrics struct {
+	registry *metricsRegistry
+
+	wrkchainHeight *metric
+	recordedHeight *metric
+	lagBlocks      *metric
+	lagSeconds     *metric
+	lastRecordedAt time.Time
+
+	txsSubmitted   *metric
+	txsSucceeded   *metric
+	txsFailed      *metric
+	balance        *metric
+	balanceLow     *metric
+	fundsRemaining *metric
+	pendingTxs     *metric
+	budgetSpent    *metric
+	recordInterval *metric
+
+	rpcDuration *metric
+	rpcErrors   *metric
+}
+
+// metrics the Oracle's metrics. Metrics are always collected, and are only exposed if
+// --metrics.addr is set
+var metrics = newOracleMetrics()
+
+// newOracleMetrics register the Oracle's metrics
+func newOracleMetrics() *oracleMetrics {
+	r := &metricsRegistry{}
+	return &oracleMetrics{
+		registry:       r,
+		wrkchainHeight: r.register("wrkchain_head_height", "Latest WRKChain block height", "gauge"),
+		recordedHeight: r.register("recorded_height", "Height of the last WRKChain block recorded on Mainchain", "gauge"),
+		lagBlocks:      r.register("record_lag_blocks", "Blocks between the WRKChain head and the last recorded WRKChain block", "gauge"),
+		lagSeconds:     r.register("record_lag_seconds", "Seconds since a WRKChain block was last recorded on Mainchain", "gauge"),
+		txsSubmitted:   r.register("txs_submitted_total", "Txs submitted to Mainchain", "counter", "method"),
+		txsSucceeded:   r.register("txs_succeeded_total", "Txs mined successfully on Mainchain", "counter", "method"),
+		txsFailed:      r.register("txs_failed_total", "Txs which could not be sent, or were reverted on Mainchain", "counter", "method"),
+		balance:        r.register("balance_und", "UND balance of the Oracle account", "gauge", "account"),
+		balanceLow:     r.register("balance_low", "1 if the Oracle account's balance is below the low balance threshold, otherwise 0", "gauge", "account"),
+		fundsRemaining: r.register("funds_remaining_seconds", "Estimated seconds until the Oracle account can no longer pay for recordings", "gauge", "account"),
+		pendingTxs:     r.register("pending_txs", "Txs the Oracle account has pending on Mainchain, awaiting a receipt", "gauge", "account"),
+		budgetSpent:    r.register("budget_spent_und", "UND spent recording in the current UTC day or month", "gauge", "budget"),
+		recordInterval: r.register("record_interval_seconds", "Current interval between recordings, including any stretching or pause for the recording budget", "gauge"),
+		rpcDuration:    r.registerHistogram("rpc_duration_seconds", "JSON RPC request latency, in seconds", rpcDurationBuckets, "chain", "method"),
+		rpcErrors:      r.register("rpc_errors_total", "JSON RPC requests which failed", "counter", "chain", "method"),
+	}
+}
+
+// register add a counter or gauge to the registry
+func (r *metricsRegistry) register(name string, help string, kind string, labels ...string) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := &metric{
+		name:   metricsNamespace + "_" + name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]float64),
+		hists:  make(map[string]*histogram),
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// registerHistogram add a histogram with the given bucket upper bounds to the registry
+func (r *metricsRegistry) registerHistogram(name string, help string, buckets []float64, labels ...string) *metric {
+	m := r.register(name, help, "histogram", labels...)
+	m.buckets = buckets
+	return m
+}
+
+// seriesKey the key of the series for the label values
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\x00")
+}
+
+// Set set a gauge
+func (m *metric) Set(value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[seriesKey(labelValues)] = value
+}
+
+// Add increase a counter
+func (m *metric) Add(value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[seriesKey(labelValues)] += value
+}
+
+// Inc increase a counter by one
+func (m *metric) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+// Observe add an observation to a histogram
+func (m *metric) Observe(value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := seriesKey(labelValues)
+	h, ok := m.hists[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.hists[key] = h
+	}
+	for i, bound := range m.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// labelString format the label names and values as {name="value",...}
+func labelString(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// write output the metric in the Prometheus text exposition format
+func (m *metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+
+	if m.kind != "histogram" {
+		keys := make([]string, 0, len(m.values))
+		for key := range m.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s%s %v\n", m.name, labelString(m.labels, strings.Split(key, "\x00")), m.values[key])
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(m.hists))
+	for key := range m.hists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := m.hists[key]
+		labelValues := strings.Split(key, "\x00")
+		bucketLabels := append(append([]string{}, m.labels...), "le")
+		for i, bound := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labelString(bucketLabels, append(append([]string{}, labelValues...), fmt.Sprint(bound))), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labelString(bucketLabels, append(append([]string{}, labelValues...), "+Inf")), h.count)
+		fmt.Fprintf(w, "%s_sum%s %v\n", m.name, labelString(m.labels, labelValues), h.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, labelString(m.labels, labelValues), h.count)
+	}
+}
+
+// ServeHTTP output all metrics in the Prometheus text exposition format
+func (o *oracleMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.updateLag()
+
+	o.registry.mu.Lock()
+	defer o.registry.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range o.registry.metrics {
+		m.write(w)
+	}
+}
+
+// ObserveRPC record the latency of a JSON RPC request, and whether it failed
+func (o *oracleMetrics) ObserveRPC(chain string, method string, start time.Time, err error) {
+	o.rpcDuration.Observe(time.Since(start).Seconds(), chain, method)
+	if err != nil {
+		o.rpcErrors.Inc(chain, method)
+	}
+}
+
+// SetWrkchainHeight record the latest WRKChain block height
+func (o *oracleMetrics) SetWrkchainHeight(height *big.Int) {
+	o.wrkchainHeight.Set(bigToFloat(height))
+	o.updateLag()
+}
+
+// SetRecordedHeight record the height of a WRKChain block recorded on Mainchain. Heights lower than
+// the last recorded height, from Txs mined out of order, are ignored
+func (o *oracleMetrics) SetRecordedHeight(height *big.Int) {
+	o.recordedHeight.mu.Lock()
+	current := o.recordedHeight.values[""]
+	value := bigToFloat(height)
+	if value >= current {
+		o.recordedHeight.values[""] = value
+	}
+	o.lastRecordedAt = time.Now()
+	o.recordedHeight.mu.Unlock()
+	o.updateLag()
+}
+
+// LastRecorded when a WRKChain block was last recorded on Mainchain, and whether one has been
+func (o *oracleMetrics) LastRecorded() (time.Time, bool) {
+	o.recordedHeight.mu.Lock()
+	defer o.recordedHeight.mu.Unlock()
+	return o.lastRecordedAt, !o.lastRecordedAt.IsZero()
+}
+
+// updateLag update the recording lag gauges from the WRKChain head and last recorded heights
+func (o *oracleMetrics) updateLag() {
+	o.recordedHeight.mu.Lock()
+	recorded, ok := o.recordedHeight.values[""]
+	lastRecordedAt := o.lastRecordedAt
+	o.recordedHeight.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	o.wrkchainHeight.mu.Lock()
+	head := o.wrkchainHeight.values[""]
+	o.wrkchainHeight.mu.Unlock()
+
+	if head >= recorded {
+		o.lagBlocks.Set(head - recorded)
+	}
+	o.lagSeconds.Set(time.Since(lastRecordedAt).Round(time.Second).Seconds())
+}
+
+// recordHeaderHeight the WRKChain block height recorded by a recordHeader Tx's data, which is the
+// second argument, after the 4 byte method selector and the WRKChain network ID. Returns nil for
+// other Txs
+func recordHeaderHeight(method string, data []byte) *big.Int {
+	if method != "recordHeader" || len(data) < 4+64 {
+		return nil
+	}
+	return new(big.Int).SetBytes(data[4+32 : 4+64])
+}
+
+// bigToFloat convert a big integer to a float64 metric value
+func bigToFloat(i *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(i).Float64()
+	return f
+}
+
+// startMetricsServer serve the metrics at http://addr/metrics, and the health and readiness checks
+// at /healthz and /readyz. The listener is opened before returning, so that an address already in
+// use is reported at startup
+func startMetricsServer(addr string, health *oracleHealth) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", health.ServeHealthz)
+	mux.HandleFunc("/readyz", health.ServeReadyz)
+
+	log.Info("Serving metrics", "url", "http://"+listener.Addr().String()+"/metrics")
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Warn("Metrics server stopped", "err", err)
+		}
+	}()
+	return nil
+}
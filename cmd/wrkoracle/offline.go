@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ethereum "github.com/unification-com/mainchain"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/common/hexutil"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/rlp"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// receiptPollInterval interval between checks for a broadcast Tx's receipt
+const receiptPollInterval = 5 * time.Second
+
+var (
+	signCommand = cli.Command{
+		Action:    signTx,
+		Name:      "sign",
+		Usage:     "Sign a Tx offline",
+		ArgsUsage: "<unsigned tx file>",
+		Flags: []cli.Flag{
+			AccountUnlockFlag,
+			PasswordPathFlag,
+			PasswordFDFlag,
+			StrictPermsFlag,
+			SignerFlag,
+			PolicyMaxGasPriceFlag,
+			PolicyDailySpendFlag,
+			DataDirectoryFlag,
+			MainchainChainIDFlag,
+			UndTestnetFlag,
+			SignedOutFlag,
+		},
+		Category: "ORACLE COMMANDS",
+		Description: `
+The sign command signs an unsigned Tx written by register --unsigned-out, using the keystore in the
+data directory. It does not connect to Mainchain, so can be run on an air-gapped machine. The signed
+Tx is written to --signed-out, for sending with the broadcast command.`,
+	}
+
+	broadcastCommand = cli.Command{
+		Action:    broadcastTx,
+		Name:      "broadcast",
+		Usage:     "Send a Tx signed offline",
+		ArgsUsage: "<signed tx file>",
+		Flags: []cli.Flag{
+			MainchainJSONRPCFlag,
+			MainchainMaxHeadDriftFlag,
+			MainchainChainIDFlag,
+			UndTestnetFlag,
+			TxStuckTimeoutFlag,
+		},
+		Category: "ORACLE COMMANDS",
+		Description: `
+The broadcast command sends a Tx signed by the sign command to Mainchain, and waits up to --tx.stuck
+seconds for its receipt.`,
+	}
+)
+
+// unsignedTx a Tx to be signed offline, along with the chain ID it must be signed for
+type unsignedTx struct {
+	signTxArgs
+	ChainID *hexutil.Big `json:"chainId"`
+	Method  string       `json:"method"`
+}
+
+// writeUnsignedTx write the Tx, which will be sent by account, to path for signing offline
+func writeUnsignedTx(path string, method string, account common.Address, tx *types.Transaction, chainID *big.Int) error {
+	utx := unsignedTx{
+		signTxArgs: signTxArgs{
+			From:     account,
+			To:       tx.To(),
+			Gas:      hexutil.Uint64(tx.Gas()),
+			GasPrice: hexutil.Big(*tx.GasPrice()),
+			Value:    hexutil.Big(*tx.Value()),
+			Nonce:    hexutil.Uint64(tx.Nonce()),
+			Data:     tx.Data(),
+		},
+		ChainID: (*hexutil.Big)(chainID),
+		Method:  method,
+	}
+
+	blob, err := json.MarshalIndent(utx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, blob, 0600)
+}
+
+// Transaction the unsigned Tx
+func (u *unsignedTx) Transaction() (*types.Transaction, error) {
+	if u.To == nil {
+		return nil, errors.New("Tx has no recipient")
+	}
+	if u.ChainID == nil {
+		return nil, errors.New("Tx has no chain ID")
+	}
+	gasPrice := big.Int(u.GasPrice)
+	value := big.Int(u.Value)
+	return types.NewTransaction(uint64(u.Nonce), *u.To, &value, uint64(u.Gas), &gasPrice, u.Data), nil
+}
+
+// signedOutPath the path to write the signed Tx to
+func signedOutPath(ctx *cli.Context, unsignedPath string) string {
+	if ctx.IsSet(SignedOutFlag.Name) {
+		return ctx.String(SignedOutFlag.Name)
+	}
+	return strings.TrimSuffix(unsignedPath, filepath.Ext(unsignedPath)) + ".signed"
+}
+
+func signTx(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("path to unsigned Tx file required")
+	}
+	unsignedPath := ctx.Args().First()
+
+	blob, err := ioutil.ReadFile(unsignedPath)
+	if err != nil {
+		return err
+	}
+	var utx unsignedTx
+	if err := json.Unmarshal(blob, &utx); err != nil {
+		return fmt.Errorf("invalid unsigned Tx file %s: %v", unsignedPath, err)
+	}
+	tx, err := utx.Transaction()
+	if err != nil {
+		return err
+	}
+
+	chainID := utx.ChainID.ToInt()
+	if expected, source := expectedChainID(ctx); expected != 0 && chainID.Cmp(new(big.Int).SetUint64(expected)) != 0 {
+		return fmt.Errorf("Tx is for chain ID %v, but %s expects chain ID %d", chainID, source, expected)
+	}
+
+	signer := newSigner(context.Background(), ctx)
+	if signer.Account() != utx.From {
+		return fmt.Errorf("Tx is from %s, but --%s is %s", utx.From.Hex(), AccountUnlockFlag.Name, signer.Account().Hex())
+	}
+
+	fmt.Println("Signing", utx.Method, "Tx")
+	fmt.Println("From:", utx.From.Hex())
+	fmt.Println("To:", tx.To().Hex())
+	fmt.Println("Value:", weiToUnd(tx.Value()), "UND")
+	fmt.Println("Nonce:", tx.Nonce())
+	fmt.Println("Chain ID:", chainID)
+	logTxFee(utx.Method, tx.Gas(), tx.Gas(), tx.GasPrice())
+
+	signedTx, err := signer.SignTx(context.Background(), tx, chainID)
+	if err != nil {
+		return err
+	}
+
+	raw, err := rlp.EncodeToBytes(signedTx)
+	if err != nil {
+		return err
+	}
+
+	signedPath := signedOutPath(ctx, unsignedPath)
+	if err := ioutil.WriteFile(signedPath, []byte(hexutil.Encode(raw)), 0600); err != nil {
+		return err
+	}
+
+	fmt.Println("Signed Tx", signedTx.Hash().Hex(), "written to", signedPath)
+	return nil
+}
+
+func broadcastTx(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("path to signed Tx file required")
+	}
+	signedPath := ctx.Args().First()
+
+	blob, err := ioutil.ReadFile(signedPath)
+	if err != nil {
+		return err
+	}
+	raw, err := hexutil.Decode(strings.TrimSpace(string(blob)))
+	if err != nil {
+		return fmt.Errorf("invalid signed Tx file %s: %v", signedPath, err)
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		return fmt.Errorf("invalid signed Tx file %s: %v", signedPath, err)
+	}
+
+	bgCtx := context.Background()
+	mainchainClient := connectMainchain(ctx)
+
+	from, err := types.Sender(types.NewEIP155Signer(mainchainClient.SigningChainID()), tx)
+	if err != nil {
+		return fmt.Errorf("Tx not signed for Mainchain chain ID %v: %v", mainchainClient.SigningChainID(), err)
+	}
+
+	fmt.Println("Sending Tx", tx.Hash().Hex(), "from", from.Hex(), "nonce", tx.Nonce())
+	if err := mainchainClient.SendTransaction(bgCtx, tx); err != nil {
+		return err
+	}
+
+	timeout := time.Duration(ctx.Int64(TxStuckTimeoutFlag.Name)) * time.Second
+	fmt.Println("Waiting up to", timeout, "for receipt")
+	deadline := time.After(timeout)
+	for {
+		receipt, err := mainchainClient.TransactionReceipt(bgCtx, tx.Hash())
+		if err != nil && err != ethereum.NotFound {
+			return fmt.Errorf("could not get receipt for Tx %s: %v", tx.Hash().Hex(), err)
+		}
+		if err == nil && receipt != nil {
+			if receipt.Status == types.ReceiptStatusFailed {
+				return fmt.Errorf("Tx %s failed", tx.Hash().Hex())
+			}
+			fmt.Println("Tx", tx.Hash().Hex(), "mined. Gas used", receipt.GasUsed)
+			return nil
+		}
+
+		select {
+		case <-deadline:
+			return fmt.Errorf("Tx %s not mined after %v. It may still be mined, so check for its receipt before sending another Tx at nonce %d", tx.Hash().Hex(), timeout, tx.Nonce())
+		case <-time.After(receiptPollInterval):
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/unification-com/mainchain/log"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// PasswordEnvVar environment variable the keystore password may be supplied in, e.g. by a container
+// orchestrator's secrets
+const PasswordEnvVar = "WRKORACLE_PASSWORD"
+
+// errNoPasswordSource returned when no password source is configured, and there is no terminal to prompt on
+var errNoPasswordSource = fmt.Errorf("password required. Set --%s, --%s or %s, or run interactively", PasswordPathFlag.Name, PasswordFDFlag.Name, PasswordEnvVar)
+
+var (
+	// passwordMu guards the password, which is only read once, as a file descriptor can only be
+	// read once, and the same password unlocks each of the Oracle's accounts
+	passwordMu   sync.Mutex
+	passwordRead bool
+	password     string
+	passwordErr  error
+	// passwordUnconfirmed set if the password was entered at a prompt without being repeated
+	passwordUnconfirmed bool
+)
+
+// checkSecretFile check a password, key or mnemonic file is not readable by group or others. In
+// strict mode, such files are refused. Otherwise, a warning is output
+func checkSecretFile(ctx *cli.Context, path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0044 == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%s has permissions %v, and is readable by other users. Run chmod 600 %s", path, info.Mode().Perm(), path)
+	if ctx.Bool(StrictPermsFlag.Name) {
+		return errors.New(msg)
+	}
+	if loggingConfigured {
+		log.Warn("Secret file readable by other users", "path", path, "perms", info.Mode().Perm(), "fix", "chmod 600 "+path)
+	} else {
+		fmt.Println("WARNING:", msg)
+	}
+	return nil
+}
+
+// readSecretFile read a password, key or mnemonic file, checking its permissions first
+func readSecretFile(ctx *cli.Context, path string) ([]byte, error) {
+	if err := checkSecretFile(ctx, path); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+// readPasswordFD read a password from the first line of the file descriptor
+func readPasswordFD(fd int) (string, error) {
+	f := os.NewFile(uintptr(fd), "password-fd")
+	if f == nil {
+		return "", fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("could not read password from file descriptor %d: %v", fd, err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// promptPassword prompt for a password on the terminal, without echoing it. If confirm is set, the
+// password must be entered twice
+func promptPassword(prompt string, confirm bool) (string, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errNoPasswordSource
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if confirm {
+		if err := repeatPassword(string(pass)); err != nil {
+			return "", err
+		}
+	}
+
+	return string(pass), nil
+}
+
+// repeatPassword prompt for the password again on the terminal, without echoing it, and check it
+// matches
+func repeatPassword(pass string) error {
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	repeat, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	if string(repeat) != pass {
+		return errors.New("passwords do not match")
+	}
+	return nil
+}
+
+// readPassword read the keystore password from, in order of precedence, the --password file, the
+// --password-fd file descriptor, the WRKORACLE_PASSWORD environment variable, or an interactive
+// no-echo prompt. If confirm is set, a prompted password must be entered twice, even if it was
+// first prompted for without confirm. The password is read once, and the same password is returned
+// for every account
+func readPassword(ctx *cli.Context, confirm bool) (string, error) {
+	passwordMu.Lock()
+	defer passwordMu.Unlock()
+
+	if !passwordRead {
+		passwordRead = true
+		switch {
+		case ctx.IsSet(PasswordPathFlag.Name):
+			var blob []byte
+			blob, passwordErr = readSecretFile(ctx, ctx.String(PasswordPathFlag.Name))
+			password = strings.TrimSpace(string(blob))
+		case ctx.IsSet(PasswordFDFlag.Name):
+			password, passwordErr = readPasswordFD(ctx.Int(PasswordFDFlag.Name))
+		case os.Getenv(PasswordEnvVar) != "":
+			password = os.Getenv(PasswordEnvVar)
+		default:
+			password, passwordErr = promptPassword("Password: ", confirm)
+			passwordUnconfirmed = passwordErr == nil && !confirm
+		}
+		return password, passwordErr
+	}
+
+	if confirm && passwordUnconfirmed {
+		if err := repeatPassword(password); err != nil {
+			return "", err
+		}
+		passwordUnconfirmed = false
+	}
+	return password, passwordErr
+}
+
+// passwordSourceSet whether a non-interactive password source is configured
+func passwordSourceSet(ctx *cli.Context) bool {
+	return ctx.IsSet(PasswordPathFlag.Name) || ctx.IsSet(PasswordFDFlag.Name) || os.Getenv(PasswordEnvVar) != ""
+}
+
+// readNewPassword read a new keystore password from the --new-password file, or an interactive
+// no-echo prompt
+func readNewPassword(ctx *cli.Context) (string, error) {
+	if ctx.IsSet(NewPasswordPathFlag.Name) {
+		blob, err := readSecretFile(ctx, ctx.String(NewPasswordPathFlag.Name))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(blob)), nil
+	}
+	return promptPassword("New password: ", true)
+}
+
+// confirm ask a yes or no question on the terminal. Returns false if there is no terminal
+func confirm(question string) bool {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+	fmt.Print(question, " [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// shredFile overwrite the file with random data, then zeros, before deleting it. Note that on
+// copy-on-write or journaling filesystems, and SSDs, the original data may survive elsewhere
+func shredFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	random := make([]byte, info.Size())
+	if _, err := rand.Read(random); err != nil {
+		f.Close()
+		return err
+	}
+	for _, data := range [][]byte{random, make([]byte, info.Size())} {
+		if _, err := f.WriteAt(data, 0); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errPolicyViolation returned when a Tx is refused by the signing policy
+var errPolicyViolation = errors.New("signing policy violation")
+
+// signingPolicy restricts what the Oracle's key may sign, regardless of the signer backend.
+// Only recordHeader and registerWrkChain calls to the WRKChain Root contract, and zero value
+// transfers to the account itself (used to cancel Txs and fill nonce gaps), are allowed. Each
+// Tx's gas price is capped, and the total spent per UTC day - the maximum fee plus value of each
+// Tx, plus the WRKChain Root tax on contract calls - is limited. Spending is recorded in the data directory, so that it survives restarts.
+// A treasury's policy instead allows transfers of up to maxTransfer to the Oracle's accounts, and
+// no contract calls
+type signingPolicy struct {
+	mu          sync.Mutex
+	path        string
+	account     common.Address
+	maxGasPrice *big.Int
+	dailyMax    *big.Int
+	dailyFlag   string
+	contract    bool
+	transfers   map[common.Address]bool
+	maxTransfer *big.Int
+	ledger      spendLedger
+}
+
+// spendLedger the amount spent per nonce on a single UTC day. Only the most expensive of a
+// nonce's replacements can be mined, so only it counts towards the day's spend
+type spendLedger struct {
+	Day   string              `json:"day"`
+	Spent map[uint64]*big.Int `json:"spent"`
+}
+
+// policySigner a Signer which checks each Tx against the signing policy before signing it
+type policySigner struct {
+	Signer
+	policy *signingPolicy
+}
+
+// newSigningPolicy configure the signing policy for the account from the command line
+func newSigningPolicy(ctx *cli.Context, account common.Address) (*signingPolicy, error) {
+	dailyMax, err := undToWei(ctx.String(PolicyDailySpendFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %v", PolicyDailySpendFlag.Name, err)
+	}
+
+	return loadSigningPolicy(&signingPolicy{
+		path:        policyPath(ctx, account),
+		account:     account,
+		maxGasPrice: new(big.Int).SetUint64(ctx.Uint64(PolicyMaxGasPriceFlag.Name)),
+		dailyMax:    dailyMax,
+		dailyFlag:   PolicyDailySpendFlag.Name,
+		contract:    true,
+	})
+}
+
+// newTreasuryPolicy configure the signing policy for the treasury account from the command line.
+// The treasury may only transfer up to maxTransfer at a time to the Oracle's accounts, and up to
+// --treasury.dailymax per UTC day
+func newTreasuryPolicy(ctx *cli.Context, treasury common.Address, accounts []common.Address, maxTransfer *big.Int) (*signingPolicy, error) {
+	dailyMax, err := undToWei(ctx.String(TreasuryDailyMaxFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %v", TreasuryDailyMaxFlag.Name, err)
+	}
+
+	transfers := make(map[common.Address]bool)
+	for _, account := range accounts {
+		transfers[account] = true
+	}
+
+	return loadSigningPolicy(&signingPolicy{
+		path:        policyPath(ctx, treasury),
+		account:     treasury,
+		maxGasPrice: new(big.Int).SetUint64(ctx.Uint64(PolicyMaxGasPriceFlag.Name)),
+		dailyMax:    dailyMax,
+		dailyFlag:   TreasuryDailyMaxFlag.Name,
+		transfers:   transfers,
+		maxTransfer: maxTransfer,
+	})
+}
+
+// policyPath the path of the account's spend ledger in the data directory
+func policyPath(ctx *cli.Context, account common.Address) string {
+	return filepath.Join(ctx.String(DataDirectoryFlag.Name), "policy", strings.ToLower(account.Hex())+".json")
+}
+
+// loadSigningPolicy load the policy's spend ledger from the data directory, if it exists
+func loadSigningPolicy(p *signingPolicy) (*signingPolicy, error) {
+	blob, err := ioutil.ReadFile(p.path)
+	if err == nil {
+		err = json.Unmarshal(blob, &p.ledger)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load spend ledger %s: %v", p.path, err)
+	}
+
+	return p, nil
+}
+
+// Check check the Tx is allowed by the policy, returning its cost
+func (p *signingPolicy) Check(tx *types.Transaction) (*big.Int, error) {
+	if tx.GasPrice().Cmp(p.maxGasPrice) > 0 {
+		return nil, fmt.Errorf("%v: gas price %v exceeds maximum %v", errPolicyViolation, tx.GasPrice(), p.maxGasPrice)
+	}
+
+	to := tx.To()
+	switch {
+	case to == nil:
+		return nil, fmt.Errorf("%v: contract creation not allowed", errPolicyViolation)
+	case *to == p.account:
+		if tx.Value().Sign() != 0 || len(tx.Data()) != 0 {
+			return nil, fmt.Errorf("%v: only zero value transfers to %s allowed", errPolicyViolation, p.account.Hex())
+		}
+	case p.transfers[*to]:
+		if len(tx.Data()) != 0 {
+			return nil, fmt.Errorf("%v: only plain transfers to %s allowed", errPolicyViolation, to.Hex())
+		}
+		if tx.Value().Cmp(p.maxTransfer) > 0 {
+			return nil, fmt.Errorf("%v: transfer of %v UND exceeds maximum %v UND", errPolicyViolation, weiToUnd(tx.Value()), weiToUnd(p.maxTransfer))
+		}
+	case p.contract && *to == common.HexToAddress(WRKChainRootContractAddress):
+		if err := p.checkMethod(tx); err != nil {
+			return nil, err
+		}
+		// the contract charges the tax on top of the Tx's cost, which for registerWrkChain includes
+		// the deposit sent as the Tx's value
+		return new(big.Int).Add(tx.Cost(), calcTax()), nil
+	default:
+		return nil, fmt.Errorf("%v: Txs to %s not allowed", errPolicyViolation, to.Hex())
+	}
+
+	return tx.Cost(), nil
+}
+
+// checkMethod check a WRKChain Root contract Tx calls an allowed method
+func (p *signingPolicy) checkMethod(tx *types.Transaction) error {
+	data := tx.Data()
+	if len(data) < 4 {
+		return fmt.Errorf("%v: no WRKChain Root method called", errPolicyViolation)
+	}
+
+	switch {
+	case bytes.Equal(data[:4], wrkchainRootABI.Methods["recordHeader"].Id()):
+		if tx.Value().Sign() != 0 {
+			return fmt.Errorf("%v: recordHeader must have zero value, got %v", errPolicyViolation, tx.Value())
+		}
+	case bytes.Equal(data[:4], wrkchainRootABI.Methods["registerWrkChain"].Id()):
+	default:
+		return fmt.Errorf("%v: WRKChain Root method %x not allowed", errPolicyViolation, data[:4])
+	}
+	return nil
+}
+
+// spend check the Tx's cost against the daily maximum, and record it. Caller must hold the lock
+func (p *signingPolicy) spend(nonce uint64, cost *big.Int) error {
+	today := time.Now().UTC().Format("2006-01-02")
+	if p.ledger.Day != today || p.ledger.Spent == nil {
+		p.ledger = spendLedger{
+			Day:   today,
+			Spent: make(map[uint64]*big.Int),
+		}
+	}
+
+	total := new(big.Int)
+	for n, spent := range p.ledger.Spent {
+		if n != nonce {
+			total.Add(total, spent)
+		}
+	}
+	if prev, ok := p.ledger.Spent[nonce]; ok && prev.Cmp(cost) > 0 {
+		cost = prev
+	}
+	total.Add(total, cost)
+
+	if p.dailyMax.Sign() > 0 && total.Cmp(p.dailyMax) > 0 {
+		return fmt.Errorf("%v: spend today would be %v UND, exceeding the daily maximum %v UND. Txs are refused until 00:00 UTC, unless --%s is raised", errPolicyViolation, weiToUnd(total), weiToUnd(p.dailyMax), p.dailyFlag)
+	}
+
+	p.ledger.Spent[nonce] = cost
+	return p.save()
+}
+
+// save write the spend ledger to disk. Caller must hold the lock
+func (p *signingPolicy) save() error {
+	blob, err := json.MarshalIndent(p.ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// Authorise check the Tx against the policy and record its spend. Txs are refused if the
+// spend cannot be recorded
+func (p *signingPolicy) Authorise(tx *types.Transaction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cost, err := p.Check(tx)
+	if err != nil {
+		return err
+	}
+	return p.spend(tx.Nonce(), cost)
+}
+
+// SignTx sign the Tx, if it is allowed by the signing policy
+func (s *policySigner) SignTx(bgCtx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if err := s.policy.Authorise(tx); err != nil {
+		log.Error("Signing policy refused Tx", "account", s.policy.account.Hex(), "nonce", tx.Nonce(), "err", err)
+		return nil, err
+	}
+	return s.Signer.SignTx(bgCtx, tx, chainID)
+}
+
+func (s *policySigner) String() string {
+	if s.policy.dailyMax.Sign() == 0 {
+		return fmt.Sprintf("%v (max gas price %v, no daily spend maximum)", s.Signer, s.policy.maxGasPrice)
+	}
+	return fmt.Sprintf("%v (max gas price %v, daily spend %v UND)", s.Signer, s.policy.maxGasPrice, weiToUnd(s.policy.dailyMax))
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup process groups are not used on Windows
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessGroup kill the started command. Processes it started are not killed on Windows
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+shareVersion: version of the backup share format
+maxShares: maximum number of shares, as each share is a distinct non-zero point in GF(256)
+*/
+const (
+	shareVersion = "wrkoracle-share-v1"
+	maxShares    = 255
+)
+
+// secretShare one of the shares a secret was split into. Shares from the same split share an ID
+// and the checksum of the secret, so that mixed up shares are detected
+type secretShare struct {
+	id        string
+	threshold int
+	x         byte
+	checksum  string
+	data      []byte
+}
+
+// gfMul multiply in GF(256), reducing by the AES polynomial x^8 + x^4 + x^3 + x + 1
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv the multiplicative inverse in GF(256), a^254. a must not be 0
+func gfInv(a byte) byte {
+	inv := byte(1)
+	for i := 0; i < 254; i++ {
+		inv = gfMul(inv, a)
+	}
+	return inv
+}
+
+// secretChecksum short checksum of the secret, used to verify a recovery
+func secretChecksum(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:4])
+}
+
+// splitSecret split the secret into n shares, any threshold of which recover it. Each byte of the
+// secret is the constant term of a random polynomial of degree threshold-1 over GF(256), and share
+// x holds each polynomial evaluated at x
+func splitSecret(secret []byte, n int, threshold int) ([]*secretShare, error) {
+	if threshold < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+	if n < threshold {
+		return nil, fmt.Errorf("shares (%d) must be at least the threshold (%d)", n, threshold)
+	}
+	if n > maxShares {
+		return nil, fmt.Errorf("at most %d shares", maxShares)
+	}
+
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	checksum := secretChecksum(secret)
+
+	shares := make([]*secretShare, n)
+	for i := range shares {
+		shares[i] = &secretShare{
+			id:        id,
+			threshold: threshold,
+			x:         byte(i + 1),
+			checksum:  checksum,
+			data:      make([]byte, len(secret)),
+		}
+	}
+
+	coeffs := make([]byte, threshold)
+	for i, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			// Horner's method, from the highest degree coefficient
+			var y byte
+			for j := threshold - 1; j >= 0; j-- {
+				y = gfMul(y, share.x) ^ coeffs[j]
+			}
+			share.data[i] = y
+		}
+	}
+
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+	return shares, nil
+}
+
+// combineShares recover the secret from at least threshold shares of the same split, by Lagrange
+// interpolation at x = 0. The recovered secret is verified against the shares' checksum
+func combineShares(shares []*secretShare) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	first := shares[0]
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if share.id != first.id || share.checksum != first.checksum || share.threshold != first.threshold {
+			return nil, errors.New("shares are from different backups")
+		}
+		if len(share.data) != len(first.data) {
+			return nil, errors.New("shares have different lengths")
+		}
+		if seen[share.x] {
+			return nil, fmt.Errorf("share %d given more than once", share.x)
+		}
+		seen[share.x] = true
+	}
+	if len(shares) < first.threshold {
+		return nil, fmt.Errorf("%d shares given, but %d are required", len(shares), first.threshold)
+	}
+	shares = shares[:first.threshold]
+
+	// Lagrange basis polynomials evaluated at 0. Subtraction in GF(256) is xor
+	basis := make([]byte, len(shares))
+	for i, si := range shares {
+		num, den := byte(1), byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			num = gfMul(num, sj.x)
+			den = gfMul(den, sj.x^si.x)
+		}
+		basis[i] = gfMul(num, gfInv(den))
+	}
+
+	secret := make([]byte, len(first.data))
+	for k := range secret {
+		var b byte
+		for i, share := range shares {
+			b ^= gfMul(share.data[k], basis[i])
+		}
+		secret[k] = b
+	}
+
+	if secretChecksum(secret) != first.checksum {
+		return nil, errors.New("recovered backup does not match its checksum. Check the shares are intact")
+	}
+	return secret, nil
+}
+
+// String encode the share as a single line of text, which can be printed or stored separately
+func (s *secretShare) String() string {
+	return strings.Join([]string{
+		shareVersion,
+		s.id,
+		strconv.Itoa(s.threshold),
+		strconv.Itoa(int(s.x)),
+		s.checksum,
+		hex.EncodeToString(s.data),
+	}, ":")
+}
+
+// parseSecretShare decode a share encoded by String. Whitespace, including line breaks added when
+// a share is printed or copied, is ignored
+func parseSecretShare(text string) (*secretShare, error) {
+	text = strings.Join(strings.Fields(text), "")
+	parts := strings.Split(text, ":")
+	if len(parts) != 6 || parts[0] != shareVersion {
+		return nil, errors.New("not a " + shareVersion + " share")
+	}
+	threshold, err := strconv.Atoi(parts[2])
+	if err != nil || threshold < 2 || threshold > maxShares {
+		return nil, fmt.Errorf("invalid threshold %q", parts[2])
+	}
+	x, err := strconv.Atoi(parts[3])
+	if err != nil || x < 1 || x > maxShares {
+		return nil, fmt.Errorf("invalid share number %q", parts[3])
+	}
+	data, err := hex.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid share data: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("share has no data")
+	}
+	return &secretShare{
+		id:        parts[1],
+		threshold: threshold,
+		x:         byte(x),
+		checksum:  parts[4],
+		data:      data,
+	}, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testSecret a secret the size of a private key, with zero and 0xff bytes
+var testSecret = []byte{
+	0x00, 0x01, 0x02, 0x03, 0xff, 0xfe, 0x80, 0x7f, 0x10, 0x20, 0x30, 0x40, 0x50, 0x60, 0x70, 0x00,
+	0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0xba, 0xbe, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+}
+
+// shareSubsets every subset of k of the shares, in order
+func shareSubsets(shares []*secretShare, k int) [][]*secretShare {
+	if k == 0 {
+		return [][]*secretShare{{}}
+	}
+	var subsets [][]*secretShare
+	for i := 0; i <= len(shares)-k; i++ {
+		for _, rest := range shareSubsets(shares[i+1:], k-1) {
+			subsets = append(subsets, append([]*secretShare{shares[i]}, rest...))
+		}
+	}
+	return subsets
+}
+
+// copyShare a deep copy of the share, so that it can be corrupted
+func copyShare(share *secretShare) *secretShare {
+	c := *share
+	c.data = append([]byte(nil), share.data...)
+	return &c
+}
+
+func TestSplitCombineEverySubset(t *testing.T) {
+	for _, test := range []struct{ n, threshold int }{
+		{2, 2},
+		{3, 2},
+		{5, 3},
+		{6, 6},
+	} {
+		shares, err := splitSecret(testSecret, test.n, test.threshold)
+		if err != nil {
+			t.Fatalf("%d of %d: %v", test.threshold, test.n, err)
+		}
+		if len(shares) != test.n {
+			t.Fatalf("%d of %d: %d shares", test.threshold, test.n, len(shares))
+		}
+		for k := test.threshold; k <= test.n; k++ {
+			for _, subset := range shareSubsets(shares, k) {
+				secret, err := combineShares(subset)
+				if err != nil {
+					t.Errorf("%d of %d, %d shares: %v", test.threshold, test.n, k, err)
+					continue
+				}
+				if !bytes.Equal(secret, testSecret) {
+					t.Errorf("%d of %d, %d shares: recovered %x, want %x", test.threshold, test.n, k, secret, testSecret)
+				}
+			}
+		}
+		// shares in any order
+		reversed := make([]*secretShare, len(shares))
+		for i, share := range shares {
+			reversed[len(shares)-1-i] = share
+		}
+		if secret, err := combineShares(reversed[:test.threshold]); err != nil || !bytes.Equal(secret, testSecret) {
+			t.Errorf("%d of %d, reversed: recovered %x, %v", test.threshold, test.n, secret, err)
+		}
+	}
+}
+
+func TestCombineBelowThreshold(t *testing.T) {
+	shares, err := splitSecret(testSecret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := 1; k < 3; k++ {
+		for _, subset := range shareSubsets(shares, k) {
+			if secret, err := combineShares(subset); err == nil {
+				t.Errorf("%d shares recovered %x", k, secret)
+			} else if !strings.Contains(err.Error(), "are required") {
+				t.Errorf("%d shares: unexpected error %v", k, err)
+			}
+		}
+	}
+	if _, err := combineShares(nil); err == nil {
+		t.Error("no shares accepted")
+	}
+}
+
+func TestCombineCorruptShare(t *testing.T) {
+	shares, err := splitSecret(testSecret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range testSecret {
+		corrupt := copyShare(shares[1])
+		corrupt.data[i] ^= 0x01
+		if secret, err := combineShares([]*secretShare{shares[0], corrupt}); err == nil {
+			t.Errorf("share with byte %d corrupted recovered %x", i, secret)
+		}
+	}
+
+	truncated := copyShare(shares[1])
+	truncated.data = truncated.data[:len(truncated.data)-1]
+	if _, err := combineShares([]*secretShare{shares[0], truncated}); err == nil {
+		t.Error("truncated share accepted")
+	}
+
+	renumbered := copyShare(shares[1])
+	renumbered.x = shares[2].x
+	if _, err := combineShares([]*secretShare{shares[0], renumbered}); err == nil {
+		t.Error("share with the wrong number accepted")
+	}
+}
+
+func TestCombineDuplicateShares(t *testing.T) {
+	shares, err := splitSecret(testSecret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = combineShares([]*secretShare{shares[0], shares[0]})
+	if err == nil {
+		t.Fatal("the same share twice accepted")
+	}
+	if !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("unexpected error %v", err)
+	}
+	// a copy of a share counts once, even alongside enough other shares
+	if _, err := combineShares([]*secretShare{shares[0], shares[1], copyShare(shares[0])}); err == nil {
+		t.Error("a copy of a share accepted")
+	}
+}
+
+func TestCombineMixedSplits(t *testing.T) {
+	first, err := splitSecret(testSecret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := splitSecret(testSecret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := combineShares([]*secretShare{first[0], second[1]}); err == nil {
+		t.Error("shares from different splits accepted")
+	}
+}
+
+func TestSplitSecretInvalid(t *testing.T) {
+	for _, test := range []struct{ n, threshold int }{
+		{3, 1},
+		{2, 3},
+		{maxShares + 1, 2},
+	} {
+		if _, err := splitSecret(testSecret, test.n, test.threshold); err == nil {
+			t.Errorf("%d of %d accepted", test.threshold, test.n)
+		}
+	}
+}
+
+func TestSecretShareEncoding(t *testing.T) {
+	shares, err := splitSecret(testSecret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := make([]*secretShare, len(shares))
+	for i, share := range shares {
+		// line breaks added when a share is printed are ignored
+		text := share.String()
+		wrapped := text[:20] + "\n  " + text[20:] + "\n"
+		if parsed[i], err = parseSecretShare(wrapped); err != nil {
+			t.Fatalf("share %d: %v", share.x, err)
+		}
+		if parsed[i].String() != text {
+			t.Errorf("share %d: parsed as %s, want %s", share.x, parsed[i], text)
+		}
+	}
+	if secret, err := combineShares(parsed[1:]); err != nil || !bytes.Equal(secret, testSecret) {
+		t.Errorf("parsed shares recovered %x, %v", secret, err)
+	}
+
+	text := shares[0].String()
+	for _, invalid := range []string{
+		"",
+		strings.Replace(text, shareVersion, "wrkoracle-share-v0", 1),
+		text + ":00",
+		strings.Replace(text, ":2:1:", ":1:1:", 1),
+		strings.Replace(text, ":2:1:", ":2:0:", 1),
+		strings.Replace(text, ":2:1:", ":2:256:", 1),
+		text[:strings.LastIndex(text, ":")+1] + "zz",
+		text[:strings.LastIndex(text, ":")+1],
+	} {
+		if _, err := parseSecretShare(invalid); err == nil {
+			t.Errorf("invalid share %q accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"github.com/unification-com/mainchain/accounts"
+	"github.com/unification-com/mainchain/accounts/keystore"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/common/hexutil"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/log"
+	"github.com/unification-com/mainchain/rlp"
+	"github.com/unification-com/mainchain/rpc"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"math/big"
+)
+
+// Signer signs Txs on behalf of a single Mainchain account
+type Signer interface {
+	// Account the address Txs are signed for
+	Account() common.Address
+	// SignTx sign the Tx for the given Mainchain chain ID
+	SignTx(bgCtx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	// String a description of the signer, for output
+	String() string
+}
+
+// newSigner create the signer configured on the command line. If --signer is set, Txs are
+// signed by the external signer, and the keystore is not used. Otherwise, the --account key
+// is decrypted from the keystore in the data directory using --password. Either way, each Tx
+// is checked against the signing policy before it is signed.
+func newSigner(bgCtx context.Context, ctx *cli.Context) Signer {
+	return newAccountSigner(bgCtx, ctx, accountFromFlag(ctx))
+}
+
+// newAccountSigner create the signer configured on the command line for the given account
+func newAccountSigner(bgCtx context.Context, ctx *cli.Context, account common.Address) Signer {
+	var signer Signer
+	var err error
+	if ctx.IsSet(SignerFlag.Name) {
+		signer, err = dialExternalSigner(bgCtx, ctx.String(SignerFlag.Name), account)
+	} else {
+		signer, err = openKeystoreSigner(ctx, account)
+	}
+	if err != nil {
+		Fatalf("Could not create signer for %s: %v", account.Hex(), err)
+	}
+
+	policy, err := newSigningPolicy(ctx, account)
+	if err != nil {
+		Fatalf("Could not create signing policy for %s: %v", account.Hex(), err)
+	}
+	signer = &policySigner{Signer: signer, policy: policy}
+
+	log.Info("Signing Txs", "account", account.Hex(), "signer", signer)
+	return signer
+}
+
+// keystoreSigner signs Txs with a key decrypted from the Oracle's keystore
+type keystoreSigner struct {
+	account common.Address
+	keyFile string
+	key     *ecdsa.PrivateKey
+}
+
+// openKeystoreSigner find the account in the keystore, and decrypt its key with the account password.
+// The same password is used for each of the Oracle's accounts
+func openKeystoreSigner(ctx *cli.Context, account common.Address) (*keystoreSigner, error) {
+	pass, err := readPassword(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account password: %v", err)
+	}
+	signer, err := unlockKeystoreSigner(ctx, account, pass)
+	if err != nil && len(accountsFromFlag(ctx)) > 1 {
+		// one password is read for all the accounts
+		return nil, fmt.Errorf("%v. Every --%s must decrypt with the same password", err, AccountUnlockFlag.Name)
+	}
+	return signer, err
+}
+
+// unlockKeystoreSigner find the account in the keystore, and decrypt its key with the password
+func unlockKeystoreSigner(ctx *cli.Context, account common.Address, pass string) (*keystoreSigner, error) {
+	acc, err := openKeystore(ctx).Find(accounts.Account{Address: account})
+	if err != nil {
+		return nil, fmt.Errorf("could not find account. Did you init first?: %v", err)
+	}
+
+	keyJSON, err := ioutil.ReadFile(acc.URL.Path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read keystore: %v", err)
+	}
+	key, err := keystore.DecryptKey(keyJSON, pass)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt key: %v", err)
+	}
+	if key.Address != account {
+		return nil, fmt.Errorf("key file %s contains %s", acc.URL.Path, key.Address.Hex())
+	}
+
+	return &keystoreSigner{
+		account: account,
+		keyFile: acc.URL.Path,
+		key:     key.PrivateKey,
+	}, nil
+}
+
+// Account the address Txs are signed for
+func (s *keystoreSigner) Account() common.Address {
+	return s.account
+}
+
+// SignTx sign the Tx with the decrypted key
+func (s *keystoreSigner) SignTx(bgCtx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.NewEIP155Signer(chainID), s.key)
+}
+
+func (s *keystoreSigner) String() string {
+	return "keystore " + s.keyFile
+}
+
+// externalSigner signs Txs by sending them to a separate signer process over JSON RPC, using
+// Clef's account_signTransaction API. The key never enters the Oracle's memory.
+type externalSigner struct {
+	url     string
+	client  *rpc.Client
+	account common.Address
+}
+
+// signTxArgs the Tx to be signed, in the format expected by account_signTransaction
+type signTxArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice hexutil.Big     `json:"gasPrice"`
+	Value    hexutil.Big     `json:"value"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Data     hexutil.Bytes   `json:"data"`
+}
+
+// signTxResult the response from account_signTransaction
+type signTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// dialExternalSigner connect to the external signer, which may be the path to a Unix socket or an
+// HTTP URL, and confirm it manages the account
+func dialExternalSigner(bgCtx context.Context, url string, account common.Address) (*externalSigner, error) {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not dial external signer %s: %v", url, err)
+	}
+
+	var managed []common.Address
+	if err := client.CallContext(bgCtx, &managed, "account_list"); err != nil {
+		return nil, fmt.Errorf("could not list external signer %s accounts: %v", url, err)
+	}
+	for _, addr := range managed {
+		if addr == account {
+			return &externalSigner{
+				url:     url,
+				client:  client,
+				account: account,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("external signer %s does not manage %s", url, account.Hex())
+}
+
+// Account the address Txs are signed for
+func (s *externalSigner) Account() common.Address {
+	return s.account
+}
+
+// SignTx ask the external signer to sign the Tx, and check that the signed Tx is the one
+// requested, signed by the account for the chain ID
+func (s *externalSigner) SignTx(bgCtx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := signTxArgs{
+		From:     s.account,
+		To:       tx.To(),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: hexutil.Big(*tx.GasPrice()),
+		Value:    hexutil.Big(*tx.Value()),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		Data:     tx.Data(),
+	}
+
+	var result signTxResult
+	if err := s.client.CallContext(bgCtx, &result, "account_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("external signer: %v", err)
+	}
+
+	signed := new(types.Transaction)
+	if err := rlp.DecodeBytes(result.Raw, signed); err != nil {
+		return nil, fmt.Errorf("external signer returned an invalid Tx: %v", err)
+	}
+
+	signer := types.NewEIP155Signer(chainID)
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return nil, errors.New("external signer returned a different Tx to the one requested")
+	}
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, fmt.Errorf("external signer returned a Tx not signed for chain ID %v: %v", chainID, err)
+	}
+	if sender != s.account {
+		return nil, fmt.Errorf("external signer signed with %s, not %s", sender.Hex(), s.account.Hex())
+	}
+
+	return signed, nil
+}
+
+func (s *externalSigner) String() string {
+	return "external signer " + s.url
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/crypto"
+	"github.com/unification-com/mainchain/rlp"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testSigningChainID the chain ID the Oracle asks the stub signer to sign for
+var testSigningChainID = big.NewInt(50005)
+
+// stubSigner a JSON RPC server implementing Clef's account_list and account_signTransaction, which
+// signs each Tx with key, after passing it through tamper
+type stubSigner struct {
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+	managed []common.Address
+	tamper  func(tx *types.Transaction) *types.Transaction
+}
+
+type stubRPCRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type stubRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type stubRPCResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *stubRPCError   `json:"error,omitempty"`
+}
+
+func (s *stubSigner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req stubRPCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := stubRPCResponse{Version: "2.0", ID: req.ID}
+	result, err := s.handle(req)
+	if err != nil {
+		resp.Error = &stubRPCError{Code: -32000, Message: err.Error()}
+	} else {
+		resp.Result = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *stubSigner) handle(req stubRPCRequest) (interface{}, error) {
+	switch req.Method {
+	case "account_list":
+		return s.managed, nil
+	case "account_signTransaction":
+		var args signTxArgs
+		if err := json.Unmarshal(req.Params[0], &args); err != nil {
+			return nil, err
+		}
+		tx := types.NewTransaction(uint64(args.Nonce), *args.To, args.Value.ToInt(), uint64(args.Gas), args.GasPrice.ToInt(), args.Data)
+		if s.tamper != nil {
+			tx = s.tamper(tx)
+		}
+		signed, err := types.SignTx(tx, types.NewEIP155Signer(s.chainID), s.key)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := rlp.EncodeToBytes(signed)
+		if err != nil {
+			return nil, err
+		}
+		return signTxResult{Raw: raw}, nil
+	default:
+		return nil, fmt.Errorf("the method %s does not exist/is not available", req.Method)
+	}
+}
+
+// newStubSigner start a stub signer managing a new key, and dial it as the Oracle's external signer
+func newStubSigner(t *testing.T, configure func(s *stubSigner)) (*externalSigner, *stubSigner, func()) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubSigner{
+		key:     key,
+		chainID: testSigningChainID,
+		managed: []common.Address{crypto.PubkeyToAddress(key.PublicKey)},
+	}
+	if configure != nil {
+		configure(stub)
+	}
+	server := httptest.NewServer(stub)
+
+	signer, err := dialExternalSigner(context.Background(), server.URL, crypto.PubkeyToAddress(key.PublicKey))
+	if err != nil {
+		server.Close()
+		t.Fatalf("could not dial stub signer: %v", err)
+	}
+	return signer, stub, server.Close
+}
+
+// testSignerTx a recordHeader-like Tx to the WRKChain Root contract
+func testSignerTx() *types.Transaction {
+	return types.NewTransaction(7, common.HexToAddress(WRKChainRootContractAddress), big.NewInt(0), 200000, big.NewInt(1000000000), []byte{0x01, 0x02, 0x03})
+}
+
+func TestExternalSignerSignTx(t *testing.T) {
+	signer, stub, stop := newStubSigner(t, nil)
+	defer stop()
+
+	tx := testSignerTx()
+	signed, err := signer.SignTx(context.Background(), tx, testSigningChainID)
+	if err != nil {
+		t.Fatalf("SignTx failed: %v", err)
+	}
+
+	eip155 := types.NewEIP155Signer(testSigningChainID)
+	if eip155.Hash(signed) != eip155.Hash(tx) {
+		t.Errorf("signed Tx hash %x, want %x", eip155.Hash(signed), eip155.Hash(tx))
+	}
+	sender, err := types.Sender(eip155, signed)
+	if err != nil {
+		t.Fatalf("could not recover sender: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(stub.key.PublicKey); sender != want {
+		t.Errorf("sender %s, want %s", sender.Hex(), want.Hex())
+	}
+}
+
+func TestExternalSignerRejectsMismatch(t *testing.T) {
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		configure func(s *stubSigner)
+		want      string
+	}{
+		{
+			name: "gas price",
+			configure: func(s *stubSigner) {
+				s.tamper = func(tx *types.Transaction) *types.Transaction {
+					return types.NewTransaction(tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), new(big.Int).Mul(tx.GasPrice(), big.NewInt(10)), tx.Data())
+				}
+			},
+			want: "different Tx",
+		},
+		{
+			name: "recipient",
+			configure: func(s *stubSigner) {
+				s.tamper = func(tx *types.Transaction) *types.Transaction {
+					return types.NewTransaction(tx.Nonce(), common.HexToAddress("0x1111111111111111111111111111111111111111"), tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data())
+				}
+			},
+			want: "different Tx",
+		},
+		{
+			name: "value",
+			configure: func(s *stubSigner) {
+				s.tamper = func(tx *types.Transaction) *types.Transaction {
+					return types.NewTransaction(tx.Nonce(), *tx.To(), big.NewInt(1), tx.Gas(), tx.GasPrice(), tx.Data())
+				}
+			},
+			want: "different Tx",
+		},
+		{
+			name: "sender",
+			configure: func(s *stubSigner) {
+				// lists the account, but signs with another key
+				s.key = otherKey
+			},
+			want: "signed with",
+		},
+		{
+			name: "chain ID",
+			configure: func(s *stubSigner) {
+				s.chainID = big.NewInt(50000)
+			},
+			want: "chain ID",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signer, _, stop := newStubSigner(t, test.configure)
+			defer stop()
+
+			signed, err := signer.SignTx(context.Background(), testSignerTx(), testSigningChainID)
+			if err == nil {
+				t.Fatalf("SignTx accepted Tx %s", signed.Hash().Hex())
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error %q does not mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestDialExternalSignerUnmanagedAccount(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(&stubSigner{key: key, chainID: testSigningChainID})
+	defer server.Close()
+
+	if _, err := dialExternalSigner(context.Background(), server.URL, crypto.PubkeyToAddress(key.PublicKey)); err == nil {
+		t.Fatal("dialExternalSigner accepted an account the signer does not manage")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TreasuryPasswordEnvVar environment variable the treasury account's password may be supplied in
+const TreasuryPasswordEnvVar = "WRKORACLE_TREASURY_PASSWORD"
+
+/*
+TopUpSubmitted: the top-up Tx was sent to Mainchain
+TopUpFailed: the top-up Tx could not be signed or sent, e.g. because the daily maximum was reached
+*/
+const (
+	TopUpSubmitted = "submitted"
+	TopUpFailed    = "failed"
+)
+
+// topUpAudit an entry in the top-up audit log
+type topUpAudit struct {
+	Time      time.Time `json:"time"`
+	Treasury  string    `json:"treasury"`
+	Account   string    `json:"account"`
+	Balance   string    `json:"balance"`
+	Threshold string    `json:"threshold"`
+	Amount    string    `json:"amount"`
+	Status    string    `json:"status"`
+	Tx        string    `json:"tx,omitempty"`
+	Nonce     *uint64   `json:"nonce,omitempty"`
+	GasPrice  *big.Int  `json:"gasprice,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// treasury tops up the Oracle's accounts from a treasury keystore account. When an account's
+// balance falls below the threshold, a fixed amount is transferred to it, unless a top-up to it is
+// already pending. Transfers are signed under the treasury's own signing policy, which caps the UND
+// spent per UTC day, and every top-up is appended to the audit log
+type treasury struct {
+	mu        sync.Mutex
+	account   common.Address
+	txm       *txManager
+	balances  *balanceMonitor
+	threshold *big.Int
+	amount    *big.Int
+	auditPath string
+	failed    map[common.Address]bool
+}
+
+// readTreasuryPassword read the treasury account's password from the --treasury.password file, the
+// WRKORACLE_TREASURY_PASSWORD environment variable, or an interactive no-echo prompt
+func readTreasuryPassword(ctx *cli.Context) (string, error) {
+	switch {
+	case ctx.IsSet(TreasuryPasswordFlag.Name):
+		blob, err := readSecretFile(ctx, ctx.String(TreasuryPasswordFlag.Name))
+		return strings.TrimSpace(string(blob)), err
+	case os.Getenv(TreasuryPasswordEnvVar) != "":
+		return os.Getenv(TreasuryPasswordEnvVar), nil
+	default:
+		return promptPassword("Treasury password: ", false)
+	}
+}
+
+// newTreasury unlock the treasury account from the --treasury.* flags, to top up the Oracle's
+// accounts. Returns nil if --treasury.account is not set
+func newTreasury(ctx *cli.Context, client *MainchainClient, gas *gasStrategy, accounts []common.Address, balances *balanceMonitor) *treasury {
+	if !ctx.IsSet(TreasuryAccountFlag.Name) {
+		return nil
+	}
+
+	account := ctx.String(TreasuryAccountFlag.Name)
+	if !common.IsHexAddress(account) {
+		Fatalf("Treasury account %s not in common hex format, e.g. 0xabd123...", account)
+	}
+	address := common.HexToAddress(account)
+	for _, oracleAccount := range accounts {
+		if oracleAccount == address {
+			Fatalf("Treasury account %s must not be one of the Oracle's accounts", address.Hex())
+		}
+	}
+
+	if !ctx.IsSet(TreasuryAmountFlag.Name) {
+		Fatalf("--%s required with --%s", TreasuryAmountFlag.Name, TreasuryAccountFlag.Name)
+	}
+	amount, err := undToWei(ctx.String(TreasuryAmountFlag.Name))
+	if err != nil || amount.Sign() == 0 {
+		Fatalf("Invalid --%s: must be more than 0 UND", TreasuryAmountFlag.Name)
+	}
+
+	// nil threshold means the low balance threshold
+	var threshold *big.Int
+	if ctx.IsSet(TreasuryThresholdFlag.Name) {
+		threshold, err = undToWei(ctx.String(TreasuryThresholdFlag.Name))
+		if err != nil {
+			Fatalf("Invalid --%s: %v", TreasuryThresholdFlag.Name, err)
+		}
+	}
+
+	auditPath := filepath.Join(ctx.String(DataDirectoryFlag.Name), "treasury", "audit.log")
+	if ctx.IsSet(TreasuryAuditFlag.Name) {
+		auditPath = expandPath(ctx.String(TreasuryAuditFlag.Name))
+	}
+
+	pass, err := readTreasuryPassword(ctx)
+	if err != nil {
+		Fatalf("Failed to read treasury password: %v", err)
+	}
+	keystoreSigner, err := unlockKeystoreSigner(ctx, address, pass)
+	if err != nil {
+		Fatalf("Could not unlock treasury account %s: %v", address.Hex(), err)
+	}
+	policy, err := newTreasuryPolicy(ctx, address, accounts, amount)
+	if err != nil {
+		Fatalf("Could not create signing policy for treasury %s: %v", address.Hex(), err)
+	}
+	signer := &policySigner{Signer: keystoreSigner, policy: policy}
+
+	log.Info("Topping up accounts from treasury", "treasury", address.Hex(), "amount", weiToUnd(amount), "signer", signer, "audit", auditPath)
+
+	txm := newTxManager(ctx, client, gas, address, signer)
+	go txm.Monitor(txMonitorInterval)
+
+	return &treasury{
+		account:   address,
+		txm:       txm,
+		balances:  balances,
+		threshold: threshold,
+		amount:    amount,
+		auditPath: auditPath,
+		failed:    make(map[common.Address]bool),
+	}
+}
+
+// audit append the entry to the audit log. The log is opened for each entry, so that it can be
+// moved aside at any time
+func (t *treasury) audit(entry *topUpAudit) {
+	blob, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(t.auditPath), 0700)
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(t.auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	}
+	if err == nil {
+		_, err = f.Write(append(blob, '\n'))
+		if syncErr := f.Sync(); err == nil {
+			err = syncErr
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Error("Could not write to treasury audit log", "path", t.auditPath, "err", err)
+	}
+}
+
+// Check top up the account from the treasury if its balance is below the threshold, and no top-up
+// to it is pending
+func (t *treasury) Check(bgCtx context.Context, account common.Address, balance *big.Int) {
+	threshold := t.threshold
+	if threshold == nil {
+		threshold = t.balances.Threshold()
+	}
+	if balance.Cmp(threshold) >= 0 {
+		return
+	}
+	if t.txm.PendingTo(TxMethodTopUp, account) {
+		log.Debug("Top-up already pending", "account", account.Hex())
+		return
+	}
+
+	entry := &topUpAudit{
+		Time:      time.Now().UTC(),
+		Treasury:  t.account.Hex(),
+		Account:   account.Hex(),
+		Balance:   weiToUnd(balance).String(),
+		Threshold: weiToUnd(threshold).String(),
+		Amount:    weiToUnd(t.amount).String(),
+	}
+	fields := []interface{}{
+		"treasury", t.account.Hex(),
+		"account", account.Hex(),
+		"und", weiToUnd(balance),
+		"threshold", weiToUnd(threshold),
+		"amount", weiToUnd(t.amount),
+	}
+
+	tx, err := t.txm.Transfer(bgCtx, TxMethodTopUp, account, t.amount)
+
+	t.mu.Lock()
+	alreadyFailed := t.failed[account]
+	t.failed[account] = err != nil
+	t.mu.Unlock()
+
+	if err != nil {
+		entry.Status = TopUpFailed
+		entry.Error = err.Error()
+		t.audit(entry)
+		log.Error("Could not top up account from treasury", append(fields, "err", err)...)
+		// only raise the event once, until a top-up succeeds
+		if !alreadyFailed {
+			notify(EventTopUpFailed, "Could not top up account from treasury", append(fields, "err", err.Error())...)
+		}
+		return
+	}
+
+	nonce := tx.Nonce()
+	entry.Status = TopUpSubmitted
+	entry.Tx = tx.Hash().Hex()
+	entry.Nonce = &nonce
+	entry.GasPrice = tx.GasPrice()
+	t.audit(entry)
+
+	fields = append(fields, "tx", tx.Hash().Hex(), "nonce", nonce)
+	log.Info("Topping up account from treasury", fields...)
+	notify(EventTopUp, "Topping up account from treasury", fields...)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ethereum "github.com/unification-com/mainchain"
+	"github.com/unification-com/mainchain/common"
+	"gopkg.in/urfave/cli.v1"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	txCommand = cli.Command{
+		Name:     "tx",
+		Usage:    "Manage the Oracle account's Txs",
+		Category: "ORACLE COMMANDS",
+		Description: `
+The tx commands manage Txs sent by the Oracle account, which are tracked in the data directory.`,
+		Subcommands: []cli.Command{
+			{
+				Action:    txPending,
+				Name:      "pending",
+				Usage:     "List the account's in-flight Txs",
+				ArgsUsage: "",
+				Flags: []cli.Flag{
+					AccountUnlockFlag,
+					DataDirectoryFlag,
+					MainchainJSONRPCFlag,
+					MainchainMaxHeadDriftFlag,
+					MainchainChainIDFlag,
+					UndTestnetFlag,
+				},
+				Description: `
+The pending command lists the account's pending Txs tracked in the data directory, along with their
+status on Mainchain, and the account's confirmed and pending nonces on Mainchain.`,
+			},
+			{
+				Action:    txSpeedUp,
+				Name:      "speedup",
+				Usage:     "Replace a pending Tx with a higher gas price",
+				ArgsUsage: "",
+				Flags:     txSignFlags,
+				Description: `
+The speedup command re-signs the pending Tx with the given nonce, using a gas price increased by
+--tx.bump percent (or the current gas price strategy's price, if higher), up to --gas.price.max.`,
+			},
+			{
+				Action:    txCancel,
+				Name:      "cancel",
+				Usage:     "Cancel a pending Tx",
+				ArgsUsage: "",
+				Flags:     txSignFlags,
+				Description: `
+The cancel command replaces the pending Tx with the given nonce with a zero value transfer to the
+account itself, using a gas price increased by --tx.bump percent, up to --gas.price.max.`,
+			},
+			{
+				Action:    txResync,
+				Name:      "resync",
+				Usage:     "Reset local nonce tracking from Mainchain",
+				ArgsUsage: "",
+				Flags: []cli.Flag{
+					AccountUnlockFlag,
+					DataDirectoryFlag,
+					MainchainJSONRPCFlag,
+					MainchainMaxHeadDriftFlag,
+					MainchainChainIDFlag,
+					UndTestnetFlag,
+				},
+				Description: `
+The resync command reconciles the Txs tracked in the data directory with Mainchain. Any pending Txs
+which Mainchain no longer knows about are abandoned, so that the next Tx uses the account's pending
+nonce on Mainchain.`,
+			},
+		},
+	}
+
+	txSignFlags = []cli.Flag{
+		AccountUnlockFlag,
+		PasswordPathFlag,
+		PasswordFDFlag,
+		StrictPermsFlag,
+		SignerFlag,
+		PolicyMaxGasPriceFlag,
+		PolicyDailySpendFlag,
+		DataDirectoryFlag,
+		MainchainJSONRPCFlag,
+		MainchainMaxHeadDriftFlag,
+		MainchainChainIDFlag,
+		UndTestnetFlag,
+		GasPriceStrategyFlag,
+		GasPriceFlag,
+		GasPricePercentileFlag,
+		GasPriceBlocksFlag,
+		GasPriceMaxFlag,
+		TxGasBumpFlag,
+		TxNonceFlag,
+	}
+
+	errTxNonceRequired = errors.New("--nonce required")
+)
+
+// accountFromFlag the --account address, without unlocking it
+func accountFromFlag(ctx *cli.Context) common.Address {
+	account, err := parseAccountFlag(ctx)
+	if err != nil {
+		Fatalf("%v", err)
+	}
+	return account
+}
+
+// parseAccountFlag the --account address, or an error if it is not set or not an address
+func parseAccountFlag(ctx *cli.Context) (common.Address, error) {
+	if !ctx.IsSet(AccountUnlockFlag.Name) {
+		return common.Address{}, errors.New("Account required")
+	}
+	account := strings.TrimSpace(ctx.String(AccountUnlockFlag.Name))
+	if !common.IsHexAddress(account) {
+		return common.Address{}, fmt.Errorf("Account %s not in common hex format, e.g. 0xabd123...", account)
+	}
+	return common.HexToAddress(account), nil
+}
+
+// accountsFromFlag the comma separated list of --account addresses, without unlocking them
+func accountsFromFlag(ctx *cli.Context) []common.Address {
+	if !ctx.IsSet(AccountUnlockFlag.Name) {
+		Fatalf("Account required")
+	}
+	var addresses []common.Address
+	seen := make(map[common.Address]bool)
+	for _, account := range strings.Split(ctx.String(AccountUnlockFlag.Name), ",") {
+		account = strings.TrimSpace(account)
+		if !common.IsHexAddress(account) {
+			Fatalf("Account %s not in common hex format, e.g. 0xabd123...", account)
+		}
+		address := common.HexToAddress(account)
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// unlockedTxManager create a signer for --account, and a Tx manager to sign and send its Txs
+func unlockedTxManager(bgCtx context.Context, ctx *cli.Context) *txManager {
+	signer := newSigner(bgCtx, ctx)
+	mainchainClient := connectMainchain(ctx)
+	return newTxManager(ctx, mainchainClient, newGasStrategy(ctx, mainchainClient), signer.Account(), signer)
+}
+
+func txPending(ctx *cli.Context) error {
+	bgCtx := context.Background()
+	account := accountFromFlag(ctx)
+	mainchainClient := connectMainchain(ctx)
+	txm := newTxManager(ctx, mainchainClient, nil, account, nil)
+
+	confirmedNonce, err := mainchainClient.NonceAt(bgCtx, account, nil)
+	if err != nil {
+		return err
+	}
+	pendingNonce, err := mainchainClient.PendingNonceAt(bgCtx, account)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Account:", account.Hex())
+	fmt.Println("Confirmed nonce:", confirmedNonce)
+	fmt.Println("Pending nonce:", pendingNonce)
+	fmt.Println("In-flight Txs on Mainchain:", pendingNonce-confirmedNonce)
+	fmt.Println()
+
+	pending := txm.store.Pending()
+	if len(pending) == 0 {
+		fmt.Println("No pending Txs in the Tx store")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "NONCE\tMETHOD\tHASH\tGAS PRICE\tREPLACEMENTS\tAGE\tMAINCHAIN")
+	for _, t := range pending {
+		status := "pending"
+		if t.Nonce < confirmedNonce {
+			status = "nonce mined"
+		} else if _, isPending, err := mainchainClient.TransactionByHash(bgCtx, t.Tx.Hash()); err == ethereum.NotFound {
+			status = "unknown"
+		} else if err != nil {
+			status = err.Error()
+		} else if !isPending {
+			status = "mined"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%d\t%v\t%s\n",
+			t.Nonce,
+			t.Method,
+			t.Tx.Hash().Hex(),
+			t.Tx.GasPrice(),
+			len(t.Hashes)-1,
+			time.Since(t.FirstSubmittedAt).Round(time.Second),
+			status,
+		)
+	}
+	return nil
+}
+
+func txSpeedUp(ctx *cli.Context) error {
+	if !ctx.IsSet(TxNonceFlag.Name) {
+		return errTxNonceRequired
+	}
+
+	bgCtx := context.Background()
+	txm := unlockedTxManager(bgCtx, ctx)
+
+	tx, err := txm.SpeedUp(bgCtx, ctx.Uint64(TxNonceFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Replacement Tx sent:", tx.Hash().Hex())
+	return nil
+}
+
+func txCancel(ctx *cli.Context) error {
+	if !ctx.IsSet(TxNonceFlag.Name) {
+		return errTxNonceRequired
+	}
+
+	bgCtx := context.Background()
+	txm := unlockedTxManager(bgCtx, ctx)
+
+	tx, err := txm.Cancel(bgCtx, ctx.Uint64(TxNonceFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Cancel Tx sent:", tx.Hash().Hex())
+	return nil
+}
+
+func txResync(ctx *cli.Context) error {
+	account := accountFromFlag(ctx)
+	mainchainClient := connectMainchain(ctx)
+	txm := newTxManager(ctx, mainchainClient, nil, account, nil)
+
+	return txm.Resync(context.Background())
+}
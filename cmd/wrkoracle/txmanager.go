@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ethereum "github.com/unification-com/mainchain"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"math/big"
+	"sync"
+	"time"
+)
+
+/*
+txMonitorInterval: interval between checks for mined, dropped and stuck Txs
+transferGas: gas used by a plain transfer
+minGasBump: minimum percentage a replacement Tx's gas price is increased by, below which nodes reject it as underpriced
+TxMethodFill: method recorded for self-transfers filling a nonce gap
+TxMethodCancel: method recorded for self-transfers cancelling a Tx
+TxMethodTopUp: method recorded for transfers from the treasury topping up an Oracle account
+*/
+const (
+	txMonitorInterval        = 30 * time.Second
+	transferGas       uint64 = 21000
+	minGasBump               = 10
+	TxMethodFill             = "fill"
+	TxMethodCancel           = "cancel"
+	TxMethodTopUp            = "topup"
+)
+
+// txManager sends Txs to the WRKChain Root contract for a single account. It assigns nonces,
+// tracks submitted Txs in the account's Tx store, and replaces Txs which have been pending
+// for too long with a higher gas price, so that later nonces are not blocked behind them.
+type txManager struct {
+	mu         sync.Mutex
+	client     *MainchainClient
+	gas        *gasStrategy
+	store      *txStore
+	account    common.Address
+	signer     Signer
+	stuckAfter time.Duration
+	bump       uint64
+}
+
+// newTxManager create a Tx manager for the account, loading its Tx store from the data directory.
+// signer may be nil if the Tx manager will only be used to inspect and reconcile Txs
+func newTxManager(ctx *cli.Context, client *MainchainClient, gas *gasStrategy, account common.Address, signer Signer) *txManager {
+	if ctx.Uint64(TxGasBumpFlag.Name) < minGasBump {
+		Fatalf("--%s must be at least %d", TxGasBumpFlag.Name, minGasBump)
+	}
+
+	store, err := openTxStore(ctx.String(DataDirectoryFlag.Name), account)
+	if err != nil {
+		Fatalf("Could not open Tx store for %s: %v", account.Hex(), err)
+	}
+
+	return &txManager{
+		client:     client,
+		gas:        gas,
+		store:      store,
+		account:    account,
+		signer:     signer,
+		stuckAfter: time.Duration(ctx.Int64(TxStuckTimeoutFlag.Name)) * time.Second,
+		bump:       ctx.Uint64(TxGasBumpFlag.Name),
+	}
+}
+
+// nextNonce the nonce for the next Tx. The account's pending nonce on Mainchain is used, unless
+// Txs tracked locally have already used it. Caller must hold the lock
+func (m *txManager) nextNonce(bgCtx context.Context) (uint64, error) {
+	nonce, err := m.client.PendingNonceAt(bgCtx, m.account)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range m.store.Pending() {
+		if t.Nonce >= nonce {
+			nonce = t.Nonce + 1
+		}
+	}
+	return nonce, nil
+}
+
+// sign sign the Tx with the account's signer. Txs are signed with the verified Mainchain chain ID
+// (EIP-155), so that they cannot be replayed on another network
+func (m *txManager) sign(bgCtx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	if m.signer == nil {
+		return nil, errors.New("account not unlocked")
+	}
+	chainID := m.client.SigningChainID()
+	if chainID == nil {
+		return nil, errors.New("Mainchain chain ID not verified")
+	}
+	return m.signer.SignTx(bgCtx, tx, chainID)
+}
+
+// Build build an unsigned Tx calling a WRKChain Root contract method, sending value wei with the
+// Tx. The gas limit and gas price are estimated, and the account's next nonce is used
+func (m *txManager) Build(bgCtx context.Context, method string, value *big.Int, args ...interface{}) (*types.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.build(bgCtx, method, value, args...)
+}
+
+// build see Build. Caller must hold the lock
+func (m *txManager) build(bgCtx context.Context, method string, value *big.Int, args ...interface{}) (*types.Transaction, error) {
+	data, err := wrkchainRootABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	contractAddress := common.HexToAddress(WRKChainRootContractAddress)
+	gasLimit, gasPrice, err := m.gas.Estimate(bgCtx, method, ethereum.CallMsg{
+		From:  m.account,
+		To:    &contractAddress,
+		Value: value,
+		Data:  data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := m.nextNonce(bgCtx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get nonce: %v", err)
+	}
+
+	return types.NewTransaction(nonce, contractAddress, value, gasLimit, gasPrice, data), nil
+}
+
+// Transact call a WRKChain Root contract method, sending value wei with the Tx
+func (m *txManager) Transact(bgCtx context.Context, method string, value *big.Int, args ...interface{}) (*types.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx, err := m.build(bgCtx, method, value, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.send(bgCtx, method, tx)
+}
+
+// Send sign and send a Tx built by Build. Returns an error if another Tx has used its nonce since
+// it was built
+func (m *txManager) Send(bgCtx context.Context, method string, tx *types.Transaction) (*types.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nonce, err := m.nextNonce(bgCtx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get nonce: %v", err)
+	}
+	if tx.Nonce() != nonce {
+		return nil, fmt.Errorf("nonce %d has been used since the Tx was built. The account's next nonce is %d", tx.Nonce(), nonce)
+	}
+
+	return m.send(bgCtx, method, tx)
+}
+
+// Transfer transfer value wei to the address, as a plain transfer
+func (m *txManager) Transfer(bgCtx context.Context, method string, to common.Address, value *big.Int) (*types.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gasPrice, err := m.gas.GasPrice(bgCtx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get gas price: %v", err)
+	}
+	logTxFee(method, transferGas, transferGas, gasPrice)
+
+	nonce, err := m.nextNonce(bgCtx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get nonce: %v", err)
+	}
+
+	return m.send(bgCtx, method, types.NewTransaction(nonce, to, value, transferGas, gasPrice, nil))
+}
+
+// send sign and send the Tx, and track it in the Tx store. Caller must hold the lock
+func (m *txManager) send(bgCtx context.Context, method string, tx *types.Transaction) (*types.Transaction, error) {
+	signedTx, err := m.sign(bgCtx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.client.SendTransaction(bgCtx, signedTx); err != nil {
+		metrics.txsFailed.Inc(method)
+		return nil, err
+	}
+	metrics.txsSubmitted.Inc(method)
+
+	if err := m.store.Add(method, signedTx); err != nil {
+		log.Warn("Could not save Tx to Tx store", "tx", signedTx.Hash().Hex(), "err", err)
+	}
+	metrics.pendingTxs.Set(float64(len(m.store.Pending())), m.account.Hex())
+
+	return signedTx, nil
+}
+
+// bumpedGasPrice the gas price for a replacement Tx. This is the greater of the current
+// strategy's gas price, and the old gas price increased by the bump percentage, capped at
+// the maximum gas price.
+func (m *txManager) bumpedGasPrice(bgCtx context.Context, oldGasPrice *big.Int) (*big.Int, error) {
+	gasPrice := new(big.Int).Mul(oldGasPrice, new(big.Int).SetUint64(100+m.bump))
+	gasPrice.Div(gasPrice, big.NewInt(100))
+
+	if current, err := m.gas.GasPrice(bgCtx); err == nil && current.Cmp(gasPrice) > 0 {
+		gasPrice = current
+	}
+
+	if max := m.gas.Max(); max != nil && gasPrice.Cmp(max) > 0 {
+		if oldGasPrice.Cmp(max) >= 0 {
+			return nil, fmt.Errorf("gas price %v already at maximum %v", oldGasPrice, max)
+		}
+		gasPrice = new(big.Int).Set(max)
+	}
+
+	return gasPrice, nil
+}
+
+// replace re-sign the tracked Tx at the same nonce with gasPrice, and send it. Caller must hold the lock
+func (m *txManager) replace(bgCtx context.Context, t trackedTx, gasPrice *big.Int) (*types.Transaction, error) {
+	old := t.Tx
+	signedTx, err := m.sign(bgCtx, types.NewTransaction(old.Nonce(), *old.To(), old.Value(), old.Gas(), gasPrice, old.Data()))
+	if err != nil {
+		return nil, err
+	}
+
+	// the gas limit is kept from the replaced Tx, so there is no new estimate
+	logTxFee(t.Method, old.Gas(), old.Gas(), gasPrice)
+
+	if err := m.client.SendTransaction(bgCtx, signedTx); err != nil {
+		return nil, err
+	}
+
+	err = m.store.Update(t.Nonce, func(t *trackedTx) {
+		t.Replaced(signedTx)
+	})
+	if err != nil {
+		log.Warn("Could not save Tx to Tx store", "tx", signedTx.Hash().Hex(), "err", err)
+	}
+
+	log.Info("Replaced Tx", "method", t.Method, "nonce", t.Nonce, "old", old.Hash().Hex(), "oldgasprice", old.GasPrice(), "tx", signedTx.Hash().Hex(), "gasprice", gasPrice)
+	return signedTx, nil
+}
+
+// SpeedUp replace the tracked Tx at the nonce with a higher gas price, regardless of how long it
+// has been pending
+func (m *txManager) SpeedUp(bgCtx context.Context, nonce uint64) (*types.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.reconcile(bgCtx); err != nil {
+		return nil, err
+	}
+
+	t, ok := m.store.Get(nonce)
+	if !ok {
+		return nil, fmt.Errorf("no Tx with nonce %d found in the Tx store %s", nonce, m.store.path)
+	}
+	if t.Status != TxStatusPending {
+		return nil, fmt.Errorf("Tx with nonce %d is no longer pending: %s", nonce, t.Status)
+	}
+
+	gasPrice, err := m.bumpedGasPrice(bgCtx, t.Tx.GasPrice())
+	if err != nil {
+		return nil, err
+	}
+	return m.replace(bgCtx, t, gasPrice)
+}
+
+// reconcile check each pending Tx's hashes for a receipt, recording which replacement was mined.
+// Caller must hold the lock
+func (m *txManager) reconcile(bgCtx context.Context) error {
+	pending := m.store.Pending()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	confirmedNonce, err := m.client.NonceAt(bgCtx, m.account, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range pending {
+		receipt, minedHash, err := m.findReceipt(bgCtx, t)
+		if err != nil {
+			return err
+		}
+
+		if receipt != nil {
+			status := TxStatusMined
+			if receipt.Status == types.ReceiptStatusFailed {
+				status = TxStatusFailed
+				metrics.txsFailed.Inc(t.Method)
+			} else {
+				metrics.txsSucceeded.Inc(t.Method)
+				if height := recordHeaderHeight(t.Method, t.Tx.Data()); height != nil {
+					metrics.SetRecordedHeight(height)
+				}
+			}
+			log.Info("Tx "+string(status), "method", t.Method, "tx", minedHash.Hex(), "nonce", t.Nonce, "gasused", receipt.GasUsed)
+			if t.Method == "recordHeader" {
+				fields := []interface{}{"account", m.account.Hex(), "tx", minedHash.Hex(), "nonce", t.Nonce, "gasused", receipt.GasUsed}
+				if height := recordHeaderHeight(t.Method, t.Tx.Data()); height != nil {
+					fields = append(fields, "height", height)
+				}
+				if status == TxStatusFailed {
+					notify(EventRecordingFailed, "recordHeader Tx reverted", fields...)
+				} else {
+					notify(EventRecordingConfirmed, "recordHeader Tx mined", fields...)
+				}
+			}
+			err = m.store.Update(t.Nonce, func(t *trackedTx) {
+				t.Status = status
+				t.MinedHash = &minedHash
+			})
+		} else if t.Nonce < confirmedNonce {
+			// nonce consumed, but none of our hashes were mined
+			log.Warn("Tx nonce was used by another Tx", "method", t.Method, "nonce", t.Nonce)
+			err = m.store.Update(t.Nonce, func(t *trackedTx) {
+				t.Status = TxStatusNonceUsed
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findReceipt look for a receipt for each of the tracked Tx's hashes
+func (m *txManager) findReceipt(bgCtx context.Context, t trackedTx) (*types.Receipt, common.Hash, error) {
+	for _, hash := range t.Hashes {
+		receipt, err := m.client.TransactionReceipt(bgCtx, hash)
+		if err == ethereum.NotFound || (err == nil && receipt == nil) {
+			continue
+		}
+		if err != nil {
+			return nil, common.Hash{}, err
+		}
+		return receipt, hash, nil
+	}
+	return nil, common.Hash{}, nil
+}
+
+// isDropped whether none of the tracked Tx's hashes are known to the Mainchain node
+func (m *txManager) isDropped(bgCtx context.Context, t trackedTx) (bool, error) {
+	for _, hash := range t.Hashes {
+		_, _, err := m.client.TransactionByHash(bgCtx, hash)
+		if err == nil {
+			return false, nil
+		}
+		if err != ethereum.NotFound {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// resubmitDropped resend pending Txs which the Mainchain node no longer knows about, for example
+// because it restarted and lost its mempool. The signed Tx is resent as-is, and if the node rejects
+// it, it is re-signed at the same nonce with a bumped gas price. Caller must hold the lock
+func (m *txManager) resubmitDropped(bgCtx context.Context) error {
+	for _, t := range m.store.Pending() {
+		dropped, err := m.isDropped(bgCtx, t)
+		if err != nil {
+			return err
+		}
+		if !dropped {
+			continue
+		}
+
+		log.Warn("Tx was dropped - resubmitting", "method", t.Method, "tx", t.Tx.Hash().Hex(), "nonce", t.Nonce)
+
+		err = m.client.SendTransaction(bgCtx, t.Tx)
+		if err == nil {
+			if err := m.store.Update(t.Nonce, func(t *trackedTx) { t.SubmittedAt = time.Now() }); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("Could not resubmit Tx - re-signing", "tx", t.Tx.Hash().Hex(), "nonce", t.Nonce, "err", err)
+
+		// the same nonce, gas and gas price would be the same Tx, rejected in the same way, so the
+		// gas price is bumped
+		gasPrice, err := m.bumpedGasPrice(bgCtx, t.Tx.GasPrice())
+		if err != nil {
+			log.Warn("Could not re-sign dropped Tx", "nonce", t.Nonce, "err", err)
+			continue
+		}
+		if _, err := m.replace(bgCtx, t, gasPrice); err != nil {
+			log.Warn("Could not re-sign dropped Tx", "nonce", t.Nonce, "err", err)
+		}
+	}
+	return nil
+}
+
+// sendSelfTransfer send a zero value transfer to the account itself at the nonce
+func (m *txManager) sendSelfTransfer(bgCtx context.Context, method string, nonce uint64, gasPrice *big.Int) (*types.Transaction, error) {
+	signedTx, err := m.sign(bgCtx, types.NewTransaction(nonce, m.account, big.NewInt(0), transferGas, gasPrice, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	logTxFee(method, transferGas, transferGas, gasPrice)
+
+	if err := m.client.SendTransaction(bgCtx, signedTx); err != nil {
+		metrics.txsFailed.Inc(method)
+		return nil, err
+	}
+	metrics.txsSubmitted.Inc(method)
+	return signedTx, nil
+}
+
+// fillNonceGaps fill any nonces missing between the account's pending nonce on Mainchain and the
+// highest locally tracked pending Tx, which would otherwise stall every later Tx. Gaps are filled
+// with zero value self-transfers. Caller must hold the lock
+func (m *txManager) fillNonceGaps(bgCtx context.Context) error {
+	pending := m.store.Pending()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tracked := make(map[uint64]bool)
+	for _, t := range pending {
+		tracked[t.Nonce] = true
+	}
+	highest := pending[len(pending)-1].Nonce
+
+	pendingNonce, err := m.client.PendingNonceAt(bgCtx, m.account)
+	if err != nil {
+		return err
+	}
+
+	for nonce := pendingNonce; nonce < highest; nonce++ {
+		if tracked[nonce] {
+			continue
+		}
+		gasPrice, err := m.gas.GasPrice(bgCtx)
+		if err != nil {
+			return err
+		}
+		log.Warn("Nonce gap - filling with a self-transfer", "nonce", nonce)
+		tx, err := m.sendSelfTransfer(bgCtx, TxMethodFill, nonce, gasPrice)
+		if err != nil {
+			return fmt.Errorf("could not fill nonce %d: %v", nonce, err)
+		}
+		log.Info("Nonce gap filled", "nonce", nonce, "tx", tx.Hash().Hex())
+		if err := m.store.Add(TxMethodFill, tx); err != nil {
+			log.Warn("Could not save Tx to Tx store", "tx", tx.Hash().Hex(), "err", err)
+		}
+	}
+	return nil
+}
+
+// replaceStuck replace Txs which have been pending for longer than the stuck timeout. Caller must hold the lock
+func (m *txManager) replaceStuck(bgCtx context.Context) {
+	for _, t := range m.store.Pending() {
+		if time.Since(t.SubmittedAt) < m.stuckAfter {
+			continue
+		}
+
+		log.Info("Tx stuck", "method", t.Method, "tx", t.Tx.Hash().Hex(), "nonce", t.Nonce, "pending", time.Since(t.FirstSubmittedAt).Round(time.Second))
+		notify(EventNonceStuck, "Tx stuck - replacing with a higher gas price", "account", m.account.Hex(), "method", t.Method, "tx", t.Tx.Hash().Hex(), "nonce", t.Nonce, "pending", time.Since(t.FirstSubmittedAt).Round(time.Second))
+
+		gasPrice, err := m.bumpedGasPrice(bgCtx, t.Tx.GasPrice())
+		if err != nil {
+			log.Warn("Could not replace stuck Tx", "nonce", t.Nonce, "err", err)
+			continue
+		}
+		if _, err := m.replace(bgCtx, t, gasPrice); err != nil {
+			log.Warn("Could not replace stuck Tx", "nonce", t.Nonce, "err", err)
+		}
+	}
+}
+
+// check reconcile pending Txs with Mainchain, resubmitting dropped Txs, filling nonce gaps and
+// replacing stuck Txs
+func (m *txManager) check(bgCtx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer func() {
+		metrics.pendingTxs.Set(float64(len(m.store.Pending())), m.account.Hex())
+	}()
+
+	if err := m.reconcile(bgCtx); err != nil {
+		log.Warn("Could not reconcile pending Txs", "account", m.account.Hex(), "err", err)
+		return
+	}
+	if err := m.resubmitDropped(bgCtx); err != nil {
+		log.Warn("Could not resubmit dropped Txs", "account", m.account.Hex(), "err", err)
+		return
+	}
+	if err := m.fillNonceGaps(bgCtx); err != nil {
+		log.Warn("Could not fill nonce gaps", "account", m.account.Hex(), "err", err)
+		return
+	}
+	m.replaceStuck(bgCtx)
+}
+
+// Cancel replace the Tx at the nonce with a zero value self-transfer at a higher gas price. If the
+// Tx is not tracked locally, the current gas price is bumped instead. The nonce must not be above
+// the account's pending nonce on Mainchain
+func (m *txManager) Cancel(bgCtx context.Context, nonce uint64) (*types.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.reconcile(bgCtx); err != nil {
+		return nil, err
+	}
+
+	confirmedNonce, err := m.client.NonceAt(bgCtx, m.account, nil)
+	if err != nil {
+		return nil, err
+	}
+	if nonce < confirmedNonce {
+		return nil, fmt.Errorf("nonce %d has already been mined", nonce)
+	}
+	// a cancel above the pending nonce would leave a nonce gap, and never be mined
+	pendingNonce, err := m.client.PendingNonceAt(bgCtx, m.account)
+	if err != nil {
+		return nil, err
+	}
+	if nonce > pendingNonce {
+		return nil, fmt.Errorf("nonce %d is above the account's pending nonce %d", nonce, pendingNonce)
+	}
+
+	t, tracked := m.store.Get(nonce)
+	tracked = tracked && t.Status == TxStatusPending
+
+	oldGasPrice := new(big.Int)
+	if tracked {
+		oldGasPrice = t.Tx.GasPrice()
+	} else if oldGasPrice, err = m.gas.GasPrice(bgCtx); err != nil {
+		return nil, err
+	}
+
+	gasPrice, err := m.bumpedGasPrice(bgCtx, oldGasPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	// sendSelfTransfer logs the cancel's fee
+	tx, err := m.sendSelfTransfer(bgCtx, TxMethodCancel, nonce, gasPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	if tracked {
+		err = m.store.Update(nonce, func(t *trackedTx) {
+			t.Method = TxMethodCancel
+			t.Replaced(tx)
+		})
+	} else {
+		err = m.store.Add(TxMethodCancel, tx)
+	}
+	if err != nil {
+		log.Warn("Could not save Tx to Tx store", "tx", tx.Hash().Hex(), "err", err)
+	}
+
+	return tx, nil
+}
+
+// Resync reset local nonce tracking from Mainchain. Pending Txs are reconciled, and any which
+// are no longer known to Mainchain are abandoned, so that the next Tx uses the account's
+// pending nonce on Mainchain
+func (m *txManager) Resync(bgCtx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.reconcile(bgCtx); err != nil {
+		return err
+	}
+
+	for _, t := range m.store.Pending() {
+		dropped, err := m.isDropped(bgCtx, t)
+		if err != nil {
+			return err
+		}
+		if !dropped {
+			continue
+		}
+		log.Info("Abandoning Tx", "method", t.Method, "tx", t.Tx.Hash().Hex(), "nonce", t.Nonce)
+		err = m.store.Update(t.Nonce, func(t *trackedTx) {
+			t.Status = TxStatusAbandoned
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	nonce, err := m.nextNonce(bgCtx)
+	if err != nil {
+		return err
+	}
+	log.Info("Next nonce", "account", m.account.Hex(), "nonce", nonce)
+	return nil
+}
+
+// PendingTo whether a Tx for the method, sent to the address, is pending
+func (m *txManager) PendingTo(method string, to common.Address) bool {
+	for _, t := range m.store.Pending() {
+		if t.Method == method && t.Tx.To() != nil && *t.Tx.To() == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Stuck whether any of the account's pending Txs have been pending for longer than the stuck timeout
+func (m *txManager) Stuck() bool {
+	for _, t := range m.store.Pending() {
+		if time.Since(t.SubmittedAt) >= m.stuckAfter {
+			return true
+		}
+	}
+	return false
+}
+
+// Monitor check pending Txs on startup, and then periodically
+func (m *txManager) Monitor(interval time.Duration) {
+	for {
+		m.check(context.Background())
+		<-time.After(interval)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/unification-com/mainchain/common"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+TxStatusPending: Tx submitted, and not yet mined
+TxStatusMined: one of the Tx's hashes was mined, and succeeded
+TxStatusFailed: one of the Tx's hashes was mined, and failed
+TxStatusNonceUsed: the Tx's nonce was used by a Tx not submitted by the Oracle
+TxStatusAbandoned: the Tx was dropped by Mainchain, and abandoned by tx resync
+*/
+const (
+	TxStatusPending   = "pending"
+	TxStatusMined     = "mined"
+	TxStatusFailed    = "failed"
+	TxStatusNonceUsed = "nonce used"
+	TxStatusAbandoned = "abandoned"
+)
+
+// maxTxHistory number of completed Txs kept in the Tx store
+const maxTxHistory = 100
+
+// trackedTx a Tx submitted to Mainchain, along with the hashes of every replacement sent at
+// the same nonce. Tx is the most recently signed replacement.
+type trackedTx struct {
+	Nonce            uint64             `json:"nonce"`
+	Method           string             `json:"method"`
+	Status           string             `json:"status"`
+	Hashes           []common.Hash      `json:"hashes"`
+	MinedHash        *common.Hash       `json:"minedHash,omitempty"`
+	Tx               *types.Transaction `json:"tx"`
+	FirstSubmittedAt time.Time          `json:"firstSubmittedAt"`
+	SubmittedAt      time.Time          `json:"submittedAt"`
+}
+
+// Replaced add a replacement for the Tx, signed at the same nonce
+func (t *trackedTx) Replaced(tx *types.Transaction) {
+	t.Tx = tx
+	t.Hashes = append(t.Hashes, tx.Hash())
+	t.SubmittedAt = time.Now()
+}
+
+// txStore persists the Txs submitted by an account to a JSON file in the data directory, so
+// that they can be tracked across restarts. The store may be shared by several processes, e.g. the
+// record command and the tx commands, so each change is made under an exclusive lock on the store,
+// to the store as last written by any process
+type txStore struct {
+	mu      sync.Mutex
+	path    string
+	account common.Address
+	txs     map[uint64]*trackedTx
+	loaded  os.FileInfo
+}
+
+// txStorePath the path to the Tx store file for the account
+func txStorePath(dataDir string, account common.Address) string {
+	return filepath.Join(dataDir, "txs", strings.ToLower(account.Hex())+".json")
+}
+
+// openTxStore load the Tx store for the account, creating it if it does not yet exist
+func openTxStore(dataDir string, account common.Address) (*txStore, error) {
+	s := &txStore{
+		path:    txStorePath(dataDir, account),
+		account: account,
+		txs:     make(map[uint64]*trackedTx),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load read the Tx store from disk, if another process has saved it since it was last loaded or
+// saved. The store is always replaced by renaming, so a changed store is a different file. Caller
+// must hold the lock
+func (s *txStore) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.loaded != nil && os.SameFile(info, s.loaded) {
+		return nil
+	}
+
+	blob, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var txs []*trackedTx
+	if err := json.Unmarshal(blob, &txs); err != nil {
+		return err
+	}
+	s.txs = make(map[uint64]*trackedTx)
+	for _, t := range txs {
+		s.txs[t.Nonce] = t
+	}
+	s.loaded = info
+	return nil
+}
+
+// refresh reload the Tx store before it is read, keeping the Txs in memory if it can't be. Caller
+// must hold the lock
+func (s *txStore) refresh() {
+	if err := s.load(); err != nil {
+		log.Warn("Could not reload Tx store", "path", s.path, "err", err)
+	}
+}
+
+// modify reload the Tx store under an exclusive lock on the store file, apply fn, and save it, so
+// that changes saved by other processes are not overwritten. Caller must hold the lock
+func (s *txStore) modify(fn func()) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	fn()
+	return s.save()
+}
+
+// sorted the tracked Txs, in nonce order. Caller must hold the lock
+func (s *txStore) sorted() []*trackedTx {
+	txs := make([]*trackedTx, 0, len(s.txs))
+	for _, t := range s.txs {
+		txs = append(txs, t)
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].Nonce < txs[j].Nonce
+	})
+	return txs
+}
+
+// save write the Tx store to disk, pruning the oldest completed Txs. Caller must hold the lock, and
+// the lock on the store file
+func (s *txStore) save() error {
+	txs := s.sorted()
+
+	completed := 0
+	for i := len(txs) - 1; i >= 0; i-- {
+		if txs[i].Status == TxStatusPending {
+			continue
+		}
+		completed++
+		if completed > maxTxHistory {
+			delete(s.txs, txs[i].Nonce)
+		}
+	}
+
+	blob, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.loaded = info
+	return nil
+}
+
+// Add track a newly submitted Tx
+func (s *txStore) Add(method string, tx *types.Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	return s.modify(func() {
+		s.txs[tx.Nonce()] = &trackedTx{
+			Nonce:            tx.Nonce(),
+			Method:           method,
+			Status:           TxStatusPending,
+			Hashes:           []common.Hash{tx.Hash()},
+			Tx:               tx,
+			FirstSubmittedAt: now,
+			SubmittedAt:      now,
+		}
+	})
+}
+
+// Update apply fn to the Tx tracked at the nonce, then save the store
+func (s *txStore) Update(nonce uint64, fn func(t *trackedTx)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.modify(func() {
+		if t, ok := s.txs[nonce]; ok {
+			fn(t)
+		}
+	})
+}
+
+// Get a copy of the Tx tracked at the nonce
+func (s *txStore) Get(nonce uint64) (trackedTx, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh()
+	t, ok := s.txs[nonce]
+	if !ok {
+		return trackedTx{}, false
+	}
+	return *t, true
+}
+
+// Pending copies of the Txs which have not yet been mined, in nonce order
+func (s *txStore) Pending() []trackedTx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh()
+	var pending []trackedTx
+	for _, t := range s.sorted() {
+		if t.Status == TxStatusPending {
+			pending = append(pending, *t)
+		}
+	}
+	return pending
+}
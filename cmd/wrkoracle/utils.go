@@ -2,10 +2,14 @@ package main
 
 import (
 	"fmt"
+	"github.com/unification-com/mainchain/log"
 	"io"
+	"math"
+	"math/big"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 // DefaultDataDir is the default data directory to use for the databases and other
@@ -28,8 +32,12 @@ func DefaultDataDir() string {
 
 // Fatalf formats a message to standard error and exits the program.
 // The message is also printed to standard output if standard error
-// is redirected to a different file.
+// is redirected to a different file. Once logging is set up, the
+// message is logged at critical level instead, which also exits.
 func Fatalf(format string, args ...interface{}) {
+	if loggingConfigured {
+		log.Crit(fmt.Sprintf(format, args...))
+	}
 	w := io.MultiWriter(os.Stdout, os.Stderr)
 	if runtime.GOOS == "windows" {
 		// The SameFile check below doesn't work on Windows.
@@ -50,6 +58,23 @@ func Fatalf(format string, args ...interface{}) {
 // MkDataDir calls the OS mkdir command to created the directory path
 func MkDataDir(dirPath string) {
 	if err := os.MkdirAll(dirPath, 0700); err != nil {
-		Fatalf("Could not create datadir", "datadir", dirPath, "err", err)
+		Fatalf("Could not create datadir %s: %v", dirPath, err)
+	}
+}
+
+// weiToUnd convert an amount in wei to UND
+func weiToUnd(wei *big.Int) *big.Float {
+	weiFloat := new(big.Float)
+	weiFloat.SetString(wei.String())
+	return new(big.Float).Quo(weiFloat, big.NewFloat(math.Pow10(18)))
+}
+
+// undToWei convert a decimal amount of UND to wei
+func undToWei(und string) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(und))
+	if !ok || r.Sign() < 0 {
+		return nil, fmt.Errorf("invalid UND amount %s", und)
 	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)))
+	return new(big.Int).Quo(r.Num(), r.Denom()), nil
 }
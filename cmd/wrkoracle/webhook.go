@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/unification-com/mainchain/log"
+	"gopkg.in/urfave/cli.v1"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+webhookTimeout: maximum time a single webhook POST may take
+webhookBackoff: delay before the first retry, doubled for each retry after
+webhookExitWait: maximum time the Oracle waits for webhooks to be delivered before exiting
+*/
+const (
+	webhookTimeout  = 10 * time.Second
+	webhookBackoff  = 2 * time.Second
+	webhookExitWait = 30 * time.Second
+)
+
+/*
+WebhookEventHeader: HTTP header holding the event type
+WebhookSignatureHeader: HTTP header holding the HMAC-SHA256 of the body, if a secret is configured
+*/
+const (
+	WebhookEventHeader     = "X-Wrkoracle-Event"
+	WebhookSignatureHeader = "X-Wrkoracle-Signature"
+)
+
+var webhookCommand = cli.Command{
+	Action:    testWebhooks,
+	Name:      "webhook",
+	Usage:     "Send a test event to the configured webhooks",
+	ArgsUsage: "",
+	Flags: []cli.Flag{
+		WebhookURLFlag,
+		WebhookEventsFlag,
+		WebhookSecretFlag,
+		WebhookRetriesFlag,
+		StrictPermsFlag,
+	},
+	Category: "ORACLE COMMANDS",
+	Description: `
+The webhook command sends a test event to each --webhook.url, using the same signing and retries
+as record, and reports whether it was delivered.`,
+}
+
+// webhookNotifier a notification hook which POSTs events as JSON to a webhook URL
+type webhookNotifier struct {
+	url     string
+	events  map[string]bool
+	secret  []byte
+	retries int
+	backoff time.Duration
+	client  *http.Client
+}
+
+// newWebhookNotifiers create a webhook notifier for each --webhook.url. Returns no notifiers if
+// --webhook.url is not set
+func newWebhookNotifiers(ctx *cli.Context) ([]*webhookNotifier, error) {
+	var urls []string
+	for _, url := range strings.Split(ctx.String(WebhookURLFlag.Name), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	// nil events means all events
+	var events map[string]bool
+	if ctx.IsSet(WebhookEventsFlag.Name) {
+		events = make(map[string]bool)
+		for _, event := range strings.Split(ctx.String(WebhookEventsFlag.Name), ",") {
+			event = strings.TrimSpace(event)
+			if !isEventType(event) {
+				return nil, fmt.Errorf("unknown event %q. Must be one of %s", event, strings.Join(eventTypes, ", "))
+			}
+			events[event] = true
+		}
+	}
+
+	var secret []byte
+	if ctx.IsSet(WebhookSecretFlag.Name) {
+		blob, err := readSecretFile(ctx, ctx.String(WebhookSecretFlag.Name))
+		if err != nil {
+			return nil, fmt.Errorf("could not read webhook secret: %v", err)
+		}
+		secret = bytes.TrimSpace(blob)
+	}
+
+	notifiers := make([]*webhookNotifier, len(urls))
+	for i, url := range urls {
+		notifiers[i] = &webhookNotifier{
+			url:     url,
+			events:  events,
+			secret:  secret,
+			retries: ctx.Int(WebhookRetriesFlag.Name),
+			backoff: webhookBackoff,
+			client:  &http.Client{Timeout: webhookTimeout},
+		}
+	}
+	return notifiers, nil
+}
+
+// setupWebhooks register a webhook notifier for each --webhook.url
+func setupWebhooks(ctx *cli.Context) error {
+	notifiers, err := newWebhookNotifiers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, n := range notifiers {
+		addNotifier(n)
+		log.Info("Sending events to webhook", "url", n.url, "events", n.eventsString(), "signed", n.secret != nil)
+	}
+	return nil
+}
+
+// isEventType whether the event type is known
+func isEventType(event string) bool {
+	for _, t := range eventTypes {
+		if t == event {
+			return true
+		}
+	}
+	return false
+}
+
+// eventsString the events sent to the webhook
+func (w *webhookNotifier) eventsString() string {
+	if w.events == nil {
+		return "all"
+	}
+	var events []string
+	for _, t := range eventTypes {
+		if w.events[t] {
+			events = append(events, t)
+		}
+	}
+	return strings.Join(events, ",")
+}
+
+// sign the hex encoded HMAC-SHA256 of the body, keyed with the webhook secret
+func (w *webhookNotifier) sign(body []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post POST the body to the webhook once. Returns whether a failure is worth retrying
+func (w *webhookNotifier) post(eventType string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wrkoracle/"+Version)
+	req.Header.Set(WebhookEventHeader, eventType)
+	if w.secret != nil {
+		req.Header.Set(WebhookSignatureHeader, w.sign(body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, errors.New(resp.Status)
+	default:
+		return false, errors.New(resp.Status)
+	}
+}
+
+// send POST the event to the webhook, retrying with exponential backoff if the webhook is
+// unreachable, or responds with a 5xx or 429 status
+func (w *webhookNotifier) send(event *oracleEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(event.Type, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.retries {
+			return fmt.Errorf("%v, after %d attempt(s)", err, attempt+1)
+		}
+		log.Debug("Webhook failed - retrying", "url", w.url, "event", event.Type, "err", err, "retry", backoff)
+		<-time.After(backoff)
+		backoff *= 2
+	}
+}
+
+// Notify send the event to the webhook, if it is one of the webhook's events
+func (w *webhookNotifier) Notify(event *oracleEvent) {
+	if w.events != nil && !w.events[event.Type] {
+		return
+	}
+	if err := w.send(event); err != nil {
+		log.Warn("Could not send event to webhook", "url", w.url, "event", event.Type, "err", err)
+	}
+}
+
+func testWebhooks(ctx *cli.Context) error {
+	notifiers, err := newWebhookNotifiers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(notifiers) == 0 {
+		return fmt.Errorf("--%s required", WebhookURLFlag.Name)
+	}
+
+	event := &oracleEvent{
+		Type:    EventTest,
+		Time:    time.Now().UTC(),
+		Message: "Test event from wrkoracle",
+	}
+	failed := 0
+	for _, n := range notifiers {
+		if err := n.send(event); err != nil {
+			fmt.Println(n.url, "failed:", err)
+			failed++
+			continue
+		}
+		fmt.Println(n.url, "OK")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d webhooks failed", failed, len(notifiers))
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"gopkg.in/urfave/cli.v1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest a request received by the test webhook server
+type webhookRequest struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+// testWebhookServer an httptest server which records each request, and responds with the next of
+// its statuses, then 200 once they run out
+type testWebhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []webhookRequest
+}
+
+func newTestWebhookServer(statuses ...int) *testWebhookServer {
+	s := &testWebhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, webhookRequest{
+			event:     r.Header.Get(WebhookEventHeader),
+			signature: r.Header.Get(WebhookSignatureHeader),
+			body:      body,
+		})
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+// received the requests received so far
+func (s *testWebhookServer) received() []webhookRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]webhookRequest(nil), s.requests...)
+}
+
+// newTestWebhookNotifiers create webhook notifiers from the --webhook.* flags, as record does
+func newTestWebhookNotifiers(t *testing.T, args ...string) []*webhookNotifier {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range []cli.Flag{WebhookURLFlag, WebhookEventsFlag, WebhookSecretFlag, WebhookRetriesFlag, StrictPermsFlag} {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	notifiers, err := newWebhookNotifiers(cli.NewContext(cli.NewApp(), set, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range notifiers {
+		n.backoff = time.Millisecond
+	}
+	return notifiers
+}
+
+func testWebhookEvent(eventType string) *oracleEvent {
+	return &oracleEvent{
+		Type:    eventType,
+		Time:    time.Date(2019, 8, 1, 10, 0, 0, 0, time.UTC),
+		Message: "Test event",
+		Fields:  map[string]interface{}{"account": "0x160B51e66e51327ac31C643f7675B8A9006aEE1E"},
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	server := newTestWebhookServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "wrkoracle-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretPath := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretPath, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	notifiers := newTestWebhookNotifiers(t, "--webhook.url", server.URL, "--webhook.secret", secretPath)
+	if len(notifiers) != 1 {
+		t.Fatalf("%d notifiers, want 1", len(notifiers))
+	}
+	notifiers[0].Notify(testWebhookEvent(EventLowBalance))
+
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	if req.event != EventLowBalance {
+		t.Errorf("event header %q, want %q", req.event, EventLowBalance)
+	}
+
+	// the secret's trailing newline is not part of the key
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(req.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.signature != want {
+		t.Errorf("signature %q, want %q", req.signature, want)
+	}
+
+	var event oracleEvent
+	if err := json.Unmarshal(req.body, &event); err != nil {
+		t.Fatalf("invalid JSON body %s: %v", req.body, err)
+	}
+	if event.Type != EventLowBalance || event.Message != "Test event" || event.Fields["account"] != "0x160B51e66e51327ac31C643f7675B8A9006aEE1E" {
+		t.Errorf("unexpected body %s", req.body)
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	server := newTestWebhookServer()
+	defer server.Close()
+
+	newTestWebhookNotifiers(t, "--webhook.url", server.URL)[0].Notify(testWebhookEvent(EventLowBalance))
+
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(requests))
+	}
+	if requests[0].signature != "" {
+		t.Errorf("unsigned webhook sent signature %q", requests[0].signature)
+	}
+}
+
+func TestWebhookEventFilter(t *testing.T) {
+	server := newTestWebhookServer()
+	defer server.Close()
+
+	n := newTestWebhookNotifiers(t, "--webhook.url", server.URL, "--webhook.events", "recording_failed, low_balance")[0]
+	for _, eventType := range []string{EventRecordingConfirmed, EventLowBalance, EventWrkchainStalled, EventRecordingFailed} {
+		n.Notify(testWebhookEvent(eventType))
+	}
+
+	requests := server.received()
+	if len(requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(requests))
+	}
+	if requests[0].event != EventLowBalance || requests[1].event != EventRecordingFailed {
+		t.Errorf("events %q and %q sent, want %q and %q", requests[0].event, requests[1].event, EventLowBalance, EventRecordingFailed)
+	}
+
+	// without --webhook.events, every event is sent
+	all := newTestWebhookServer()
+	defer all.Close()
+	n = newTestWebhookNotifiers(t, "--webhook.url", all.URL)[0]
+	for _, eventType := range eventTypes {
+		n.Notify(testWebhookEvent(eventType))
+	}
+	if got := len(all.received()); got != len(eventTypes) {
+		t.Errorf("%d requests, want %d", got, len(eventTypes))
+	}
+}
+
+func TestWebhookUnknownEvent(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	WebhookURLFlag.Apply(set)
+	WebhookEventsFlag.Apply(set)
+	if err := set.Parse([]string{"--webhook.url", "http://127.0.0.1:1", "--webhook.events", "low_balance,lowbalance"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newWebhookNotifiers(cli.NewContext(cli.NewApp(), set, nil)); err == nil {
+		t.Fatal("unknown event accepted")
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  string
+		requests int
+		ok       bool
+	}{
+		{"5xx then success", []int{500, 502, 503}, "3", 4, true},
+		{"429 then success", []int{429}, "3", 2, true},
+		{"5xx until retries run out", []int{500, 500, 500, 500, 500}, "2", 3, false},
+		{"4xx not retried", []int{400}, "3", 1, false},
+		{"no retries", []int{503}, "0", 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestWebhookServer(test.statuses...)
+			defer server.Close()
+
+			n := newTestWebhookNotifiers(t, "--webhook.url", server.URL, "--webhook.retries", test.retries)[0]
+			n.backoff = 20 * time.Millisecond
+			start := time.Now()
+			err := n.send(testWebhookEvent(EventRecordingFailed))
+			elapsed := time.Since(start)
+
+			if test.ok && err != nil {
+				t.Errorf("send failed: %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Error("send succeeded")
+			}
+			requests := server.received()
+			if len(requests) != test.requests {
+				t.Errorf("%d requests, want %d", len(requests), test.requests)
+			}
+			for _, req := range requests[1:] {
+				if string(req.body) != string(requests[0].body) {
+					t.Errorf("retry body %s, want %s", req.body, requests[0].body)
+				}
+			}
+
+			// the backoff doubles for each retry: 20ms, 40ms, 80ms, ...
+			var backoff time.Duration
+			for i, delay := 1, n.backoff; i < len(requests); i, delay = i+1, delay*2 {
+				backoff += delay
+			}
+			if elapsed < backoff {
+				t.Errorf("%d requests took %v, want a backoff of at least %v", len(requests), elapsed, backoff)
+			}
+		})
+	}
+}
+
+func TestWebhookUnreachable(t *testing.T) {
+	server := newTestWebhookServer()
+	url := server.URL
+	server.Close()
+
+	n := newTestWebhookNotifiers(t, "--webhook.url", url, "--webhook.retries", "1")[0]
+	if err := n.send(testWebhookEvent(EventRecordingFailed)); err == nil {
+		t.Error("send to a closed server succeeded")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/unification-com/mainchain/accounts/abi"
+	"github.com/unification-com/mainchain/accounts/abi/bind"
+	"github.com/unification-com/mainchain/common"
+	wrkchainroot "github.com/unification-com/mainchain/contracts/wrkchainroot/contract"
+	"github.com/unification-com/mainchain/core/types"
+	"github.com/unification-com/mainchain/ethclient"
+	"github.com/unification-com/mainchain/log"
+	"github.com/unification-com/mainchain/rpc"
+	"gopkg.in/urfave/cli.v1"
+	"math/big"
+	"strings"
+)
+
+// wrkchainRootABI the parsed WRKChain Root contract ABI, for packing and decoding Tx input
+var wrkchainRootABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(wrkchainroot.WRKChainRootABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// connectWrkchain dial the WRKChain JSON RPC configured via the command line. The raw RPC
+// client is also returned, for requests not supported by ethclient
+func connectWrkchain(ctx *cli.Context) (*rpc.Client, *ethclient.Client) {
+	log.Info("Connecting to WRKChain JSON RPC", "url", ctx.String(WRKChainJSONRPCFlag.Name))
+	rpcClient, err := rpc.Dial(strings.TrimSpace(ctx.String(WRKChainJSONRPCFlag.Name)))
+	if err != nil {
+		Fatalf("Couldn't connect to WRKChain: %v", err)
+	}
+	return rpcClient, ethclient.NewClient(rpcClient)
+}
+
+// findRegistration query the WRKChain Root contract for the RegisterWrkChain event
+// emitted when the given WRKChain ID was registered. Returns nil if it has not been registered
+func findRegistration(bgCtx context.Context, session *wrkchainroot.WRKChainRootSession, wrkchainNetworkID *big.Int) (*wrkchainroot.WRKChainRootRegisterWrkChain, error) {
+	var filterOpts = new(bind.FilterOpts)
+	filterOpts.Start = 0
+	filterOpts.End = nil
+	filterOpts.Context = bgCtx
+
+	wrkchainIDFilterList := make([]*big.Int, 0)
+	wrkchainIDFilterList = append(wrkchainIDFilterList, wrkchainNetworkID)
+
+	registerWrkChainEvents, err := session.Contract.FilterRegisterWrkChain(filterOpts, wrkchainIDFilterList)
+	if err != nil {
+		return nil, err
+	}
+
+	defer registerWrkChainEvents.Close()
+
+	if registerWrkChainEvents.Next() {
+		return registerWrkChainEvents.Event, nil
+	}
+
+	return nil, registerWrkChainEvents.Error()
+}
+
+// wrkchainRegistration details of a WRKChain's registration, gathered from the
+// RegisterWrkChain event and the Tx which emitted it. AuthAddresses are the addresses authorised
+// by the registerWrkChain Tx, not the contract's current state, so changes made since are not seen
+type wrkchainRegistration struct {
+	ChainID       *big.Int
+	GenesisHash   common.Hash
+	TxHash        common.Hash
+	BlockNumber   uint64
+	Owner         common.Address
+	AuthAddresses []common.Address
+}
+
+// IsAuthorised whether the account was authorised to record WRKChain hashes when the WRKChain was
+// registered
+func (r *wrkchainRegistration) IsAuthorised(account common.Address) bool {
+	for _, authAddr := range r.AuthAddresses {
+		if authAddr == account {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupRegistration find the WRKChain's registration, and decode the authorised addresses
+// from the input of the registerWrkChain Tx. Authorisations added or removed since registration
+// are not reflected. Returns nil if it has not been registered
+func lookupRegistration(
+	bgCtx context.Context,
+	mainchainClient *MainchainClient,
+	session *wrkchainroot.WRKChainRootSession,
+	wrkchainNetworkID *big.Int,
+) (*wrkchainRegistration, error) {
+
+	event, err := findRegistration(bgCtx, session, wrkchainNetworkID)
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	registration := &wrkchainRegistration{
+		ChainID:     event.ChainId,
+		GenesisHash: common.Hash(event.GenesisHash),
+		TxHash:      event.Raw.TxHash,
+		BlockNumber: event.Raw.BlockNumber,
+	}
+
+	tx, _, err := mainchainClient.TransactionByHash(bgCtx, event.Raw.TxHash)
+	if err != nil {
+		return nil, fmt.Errorf("could not get registration Tx %s: %v", event.Raw.TxHash.Hex(), err)
+	}
+
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	if registration.Owner, err = types.Sender(signer, tx); err != nil {
+		return nil, fmt.Errorf("could not get registration Tx sender: %v", err)
+	}
+
+	method := wrkchainRootABI.Methods["registerWrkChain"]
+
+	data := tx.Data()
+	if len(data) < 4 || !bytes.Equal(data[:4], method.Id()) {
+		return nil, fmt.Errorf("Tx %s is not a registerWrkChain call", event.Raw.TxHash.Hex())
+	}
+	args, err := method.Inputs.UnpackValues(data[4:])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode registerWrkChain Tx input: %v", err)
+	}
+	authAddresses, ok := args[1].([]common.Address)
+	if !ok {
+		return nil, fmt.Errorf("unexpected registerWrkChain authorised address type %T", args[1])
+	}
+	registration.AuthAddresses = authAddresses
+
+	return registration, nil
+}
+
+// checkWrkchainRootContract confirm the WRKChain Root contract code exists on Mainchain
+func checkWrkchainRootContract(bgCtx context.Context, mainchainClient *MainchainClient) error {
+	code, err := mainchainClient.CodeAt(bgCtx, common.HexToAddress(WRKChainRootContractAddress), nil)
+	if err != nil {
+		return fmt.Errorf("could not get WRKChain Root contract code: %v", err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no WRKChain Root contract code at %s. Is --mainchain.rpc pointing to a UND Mainchain node?", WRKChainRootContractAddress)
+	}
+	return nil
+}
+
+// registrationDeposit the UND deposit, in wei, required to register a WRKChain
+func registrationDeposit(bgCtx context.Context, mainchainClient *MainchainClient) (*big.Int, error) {
+	deposit, err := mainchainClient.StorageAt(bgCtx, common.HexToAddress(WRKChainRootContractAddress), common.HexToHash(DepositStorageAddress), nil)
+	if err != nil {
+		return nil, err
+	}
+	return big.NewInt(0).SetBytes(deposit), nil
+}
+
+// checkAuthorised confirm the account was authorised to record hashes for the WRKChain when it was
+// registered, outputting the full list of accounts authorised then. Authorisations changed since
+// registration are not checked
+func checkAuthorised(registration *wrkchainRegistration, account common.Address) error {
+	authorised := make([]string, len(registration.AuthAddresses))
+	for i, authAddr := range registration.AuthAddresses {
+		authorised[i] = authAddr.Hex()
+	}
+	log.Info("WRKChain registration", "chainid", registration.ChainID, "owner", registration.Owner.Hex(), "tx", registration.TxHash.Hex(), "authorised", strings.Join(authorised, ","))
+	log.Info("Authorised accounts are those in the registration Tx. Authorisations changed since registration are not checked", "tx", registration.TxHash.Hex())
+
+	if !registration.IsAuthorised(account) {
+		notify(EventAuthMismatch, "Account is not authorised to record hashes for the WRKChain", "chainid", registration.ChainID, "account", account.Hex(), "authorised", strings.Join(authorised, ","))
+		return fmt.Errorf("account %s was not authorised to record hashes for WRKChain ID %v when it was registered in Tx %s. Run with one of the authorised accounts above as --account. Authorisations changed since registration are not checked", account.Hex(), registration.ChainID, registration.TxHash.Hex())
+	}
+	return nil
+}
+
+// verifyWrkchain confirm the node at the end of the WRKChain JSON RPC is the registered
+// WRKChain. The node's net_version and eth_chainId must agree, and the hash of its block 0
+// must match the genesis hash submitted when the WRKChain was registered. Returns the
+// verified WRKChain's registration.
+func verifyWrkchain(
+	bgCtx context.Context,
+	wrkChainRPC *rpc.Client,
+	wrkChainClient *ethclient.Client,
+	mainchainClient *MainchainClient,
+	wrkchainRootSession *wrkchainroot.WRKChainRootSession,
+) (*wrkchainRegistration, error) {
+
+	wrkchainNetworkID, err := wrkChainClient.NetworkID(bgCtx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get WRKChain Network ID: %v", err)
+	}
+
+	wrkchainChainID, err := requestChainID(bgCtx, wrkChainRPC)
+	if err != nil {
+		return nil, fmt.Errorf("could not get WRKChain Chain ID. WRKChain node must support eth_chainId: %v", err)
+	}
+
+	log.Info("WRKChain IDs", "networkid", wrkchainNetworkID, "chainid", wrkchainChainID)
+
+	if wrkchainNetworkID.Cmp(wrkchainChainID) != 0 {
+		notify(EventGenesisMismatch, "WRKChain net_version does not match eth_chainId", "networkid", wrkchainNetworkID, "chainid", wrkchainChainID)
+		return nil, fmt.Errorf("WRKChain net_version %v does not match eth_chainId %v", wrkchainNetworkID, wrkchainChainID)
+	}
+
+	genesisHeader, err := wrkChainClient.HeaderByNumber(bgCtx, big.NewInt(0))
+	if err != nil {
+		return nil, fmt.Errorf("could not get WRKChain genesis block: %v", err)
+	}
+	genesisHash := genesisHeader.GoEthereumHash()
+
+	log.Info("WRKChain genesis", "hash", genesisHash.Hex())
+
+	registration, err := lookupRegistration(bgCtx, mainchainClient, wrkchainRootSession, wrkchainNetworkID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get WRKChain registration: %v", err)
+	}
+	if registration == nil {
+		return nil, fmt.Errorf("WRKChain ID %v has not been registered. Run the register command first", wrkchainNetworkID)
+	}
+
+	log.Info("Registered genesis", "hash", registration.GenesisHash.Hex(), "tx", registration.TxHash.Hex())
+
+	if genesisHash != registration.GenesisHash {
+		notify(EventGenesisMismatch, "WRKChain genesis hash does not match registered genesis hash", "chainid", wrkchainNetworkID, "genesis", genesisHash.Hex(), "registered", registration.GenesisHash.Hex())
+		return nil, fmt.Errorf("WRKChain genesis hash %s does not match registered genesis hash %s. Is --wrkchain.rpc pointing to the correct WRKChain?", genesisHash.Hex(), registration.GenesisHash.Hex())
+	}
+
+	return registration, nil
+}